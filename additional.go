@@ -0,0 +1,61 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// WatchAdditional watches paths alongside the certificate and key
+// files, reloading the certificate and key, and any pairs added with
+// AddPair, when any of them changes, for setups where a version or
+// trigger file is touched once certificates are rotated elsewhere.
+// Their directories must exist but the files needn't. Changes are coalesced
+// with those to the certificate and key files as usual. A path that is
+// also the certificate or key file, a pair's file or another watched
+// file such as the policy or OCSP file is handled as that file rather
+// than as an additional one.
+func (cm *CertMan) WatchAdditional(paths ...string) error {
+	abs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		abs = append(abs, path)
+	}
+
+	cm.mu.Lock()
+	cm.additional = append(cm.additional, abs...)
+	cm.mu.Unlock()
+
+	if watcher := cm.currentWatcher(); watcher != nil {
+		for _, path := range abs {
+			if err := addWatch(watcher, filepath.Dir(path)); err != nil {
+				return errors.Wrap(err, "can't watch additional file")
+			}
+		}
+	}
+
+	return nil
+}
+
+// additionalEvent reports whether event concerns a file added with
+// WatchAdditional.
+func (cm *CertMan) additionalEvent(event fsnotify.Event) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	for _, path := range cm.additional {
+		if sameFile(event.Name, path) {
+			return true
+		}
+	}
+
+	return false
+}
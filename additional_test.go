@@ -0,0 +1,54 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestWatchAdditional(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	version := filepath.Join(t.TempDir(), "version")
+	other := filepath.Join(filepath.Dir(version), "other")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.WatchAdditional(version); err != nil {
+		t.Fatalf("could not watch additional file: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	reloads := cm.Stats().Reloads
+
+	if err := os.WriteFile(other, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if n := cm.Stats().Reloads - reloads; n != 0 {
+		t.Fatalf("reloaded %d times for an unwatched file", n)
+	}
+
+	if err := os.WriteFile(version, []byte("2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, cm)
+
+	if n := cm.Stats().Reloads - reloads; n != 1 {
+		t.Fatalf("reloaded %d times for the additional file, want 1", n)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+)
+
+// RestrictALPN restricts GetCertificate to clients offering at least
+// one of protos by ALPN, returning an error to abort the handshake of
+// any other client, including those offering no protocols. This
+// isolates the certificate to, for example, h2 clients. Calling it
+// with no protocols removes the restriction.
+func (cm *CertMan) RestrictALPN(protos ...string) {
+	cm.mu.Lock()
+	cm.alpn = append([]string(nil), protos...)
+	cm.storeSnapshot()
+	cm.mu.Unlock()
+}
+
+// checkALPN returns an error if the client of hello offers none of the
+// protocols set by RestrictALPN.
+func (s *serveState) checkALPN(hello *tls.ClientHelloInfo) error {
+	if len(s.alpn) == 0 {
+		return nil
+	}
+
+	for _, proto := range hello.SupportedProtos {
+		for _, allowed := range s.alpn {
+			if proto == allowed {
+				return nil
+			}
+		}
+	}
+
+	return errors.Errorf("client protocols %q not among %q", hello.SupportedProtos, s.alpn)
+}
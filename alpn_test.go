@@ -0,0 +1,53 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestRestrictALPN(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	cm.RestrictALPN("h2")
+
+	tests := []struct {
+		protos []string
+		served bool
+	}{
+		{[]string{"h2", "http/1.1"}, true},
+		{[]string{"http/1.1", "h2"}, true},
+		{[]string{"http/1.1"}, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		cert, err := cm.GetCertificate(&tls.ClientHelloInfo{SupportedProtos: tt.protos})
+		if served := err == nil && cert != nil; served != tt.served {
+			t.Errorf("protos %q: served %v, want %v (err %v)", tt.protos, served, tt.served, err)
+		}
+	}
+
+	cm.RestrictALPN()
+
+	if _, err := cm.GetCertificate(&tls.ClientHelloInfo{SupportedProtos: []string{"http/1.1"}}); err != nil {
+		t.Fatalf("not served after removing restriction: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// BindConfig keeps the Certificates field of cfg set to the served
+// certificate, replacing the slice after every reload. It is for
+// legacy servers and libraries that read Certificates, often taking a
+// copy of it, rather than calling GetCertificate.
+//
+// Updates of cfg are made under a lock so they don't interleave, but
+// crypto/tls and most other readers of a tls.Config don't take it:
+// replacing Certificates while cfg is serving handshakes is a data race
+// certman can't guard against. Only bind configs that are cloned or
+// otherwise not read while certman may be reloading, and prefer
+// GetCertificate or GetTLSConfig where possible. cfg is only updated on
+// reloads, so a pending certificate held back by SetRotationOverlap
+// isn't set until the next reload after it is served.
+func (cm *CertMan) BindConfig(cfg *tls.Config) {
+	var mu sync.Mutex
+	update := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		cm.mu.RLock()
+		keyPair := cm.keyPair
+		cm.mu.RUnlock()
+
+		if keyPair != nil {
+			cfg.Certificates = []tls.Certificate{*keyPair}
+		}
+	}
+
+	update()
+	cm.OnReload(func(ReloadEvent) { update() })
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+)
+
+func TestBindConfig(t *testing.T) {
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cfg := &tls.Config{}
+	cm.BindConfig(cfg)
+	if cfg.Certificates != nil {
+		t.Fatalf("bound config's certificates set before loading")
+	}
+
+	// Callbacks run in the order registered, on the goroutine that
+	// loaded the files, so cfg can be read here without racing with
+	// its updates.
+	bound := make(chan []tls.Certificate, 8)
+	cm.OnReload(func(certman.ReloadEvent) { bound <- cfg.Certificates })
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if !boundTo(t, bound, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("bound config doesn't hold loaded certificate")
+	}
+
+	copyFile("./testdata/server2.crt", crt)
+	copyFile("./testdata/server2.key", key)
+
+	if !boundTo(t, bound, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("bound config doesn't hold reloaded certificate")
+	}
+
+	cm.Stop()
+	expectedCert, err := tls.LoadX509KeyPair("./testdata/server2.crt", "./testdata/server2.key")
+	if err != nil {
+		t.Fatalf("could not load certificate and key files to test: %v", err)
+	}
+	other := &tls.Config{}
+	cm.BindConfig(other)
+	if len(other.Certificates) != 1 || !reflect.DeepEqual(other.Certificates[0].Certificate, expectedCert.Certificate) {
+		t.Fatalf("config bound after loading doesn't hold loaded certificate")
+	}
+}
+
+// boundTo reports whether the certificates of a bound config, sent on
+// bound after each reload, come to be the given pair.
+func boundTo(t *testing.T, bound <-chan []tls.Certificate, crt, key string) bool {
+	expectedCert, err := tls.LoadX509KeyPair(crt, key)
+	if err != nil {
+		t.Fatalf("could not load certificate and key files to test: %v", err)
+	}
+
+	for {
+		select {
+		case certs := <-bound:
+			if len(certs) == 1 && reflect.DeepEqual(certs[0].Certificate, expectedCert.Certificate) {
+				return true
+			}
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+}
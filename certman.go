@@ -7,13 +7,20 @@
 // certMan, with methods watching and getting the files.
 // Only valid certificate and key pairs are loaded and an optional
 // logger can be passed to certman for logging providing it implements
-// the logger interface.
+// the logger interface, or the leveledLogger interface to control
+// verbosity per event.
 package certman
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
@@ -25,51 +32,299 @@ type CertMan struct {
 	mu       sync.RWMutex
 	certFile string
 	keyFile  string
+	certPath string
+	keyPath  string
+	relative bool
 	keyPair  *tls.Certificate
 	watcher  *fsnotify.Watcher
 	watching chan bool
-	log      logger
+	marker   string
+	log      leveledLogger
+
+	policyFile string
+	policy     *policy
+	ocspFile   string
+	reloaded   []chan struct{}
+	quit       chan struct{}
+	sessions   []func(quit <-chan struct{})
+	failures   int
+	threshold  int
+	pairs      []*pair
+	permCheck  PermissionCheck
+	coalesce   time.Duration
+	settle     time.Duration
+	validator  func(*tls.Certificate) error
+	validated  bool
+	gated      bool
+	overlap    bool
+	pending    *tls.Certificate
+	activation *time.Timer
+	activated  []func(*tls.Certificate)
+	now        func() time.Time
+	done       chan struct{}
+	parsed     map[string]parsedPair
+	depth      int
+	recovered  []func()
+	retry      time.Duration
+	lastErr    error
+	index      *nameIndex
+	routes     []cidrRoute
+	ports      map[int]*pair
+	grace      time.Duration
+	failedAt   time.Time
+	loadedAt   time.Time
+	splitWait  bool
+	reorder    bool
+	interDir   string
+	sink       io.Writer
+	sinkMu     sync.Mutex
+	manifest   string
+	restart    chan chan error
+	handshakes atomic.Uint64
+	counters   map[*tls.Certificate]*atomic.Uint64
+	rotation   RotationCheck
+	skew       time.Duration
+	reloadMu   sync.Mutex
+	queued     *queuedReload
+	source     Source
+	keySource  KeySource
+	interval   time.Duration
+	token      string
+	polled     *sourceRead
+	keyLog     io.Writer
+	chains     []*versionChain
+	fsys       fs.FS
+	events     []chan Event
+	direct     bool
+	removed    []func(string)
+
+	permRetry    time.Duration
+	permDeadline time.Duration
+	reloadAt     time.Time
+	heartbeat    time.Duration
+	heartbeatMsg string
+	alpn         []string
+	pins         map[string]bool
+	safety       time.Duration
+	info         CertInfo
+	nonBlocking  atomic.Bool
+	snapshot     atomic.Pointer[serveState]
+	reloads      atomic.Uint64
+	loadFailures atomic.Uint64
+	firstLoad    atomic.Int64
+	lastLoad     atomic.Int64
+	watchStart   atomic.Int64
+	strictPEM    bool
+	p12Password  string
+	quietOps     fsnotify.Op
+	strictLoad   bool
+	maintenance  *tls.Certificate
+	maintAfter   time.Duration
+	maintaining  bool
+	onStopped    []func(error)
+	additional   []string
+	stapleNext   time.Time
+	metrics      Metrics
+	cnFallback   bool
+	nextReload   chan struct{}
+	passFile     string
+	onReload     []func(ReloadEvent)
+	selector     func(*tls.ClientHelloInfo, []*tls.Certificate) (*tls.Certificate, error)
+	closeWrite   bool
+
+	logRotations bool
 }
 
+// defaultMarker is the suffix of the directory symlink Kubernetes swaps
+// when it atomically updates a projected secret volume.
+const defaultMarker = "/..data"
+
 // logger is an interface that wraps the basic Printf method.
 type logger interface {
 	Printf(string, ...interface{})
 }
 
+// leveledLogger is an interface for loggers with levels. Load
+// and watch errors are logged with Errorf, degraded but serving
+// states with Warnf, loads with Infof and individual watch events
+// with Debugf.
+type leveledLogger interface {
+	Debugf(string, ...interface{})
+	Infof(string, ...interface{})
+	Warnf(string, ...interface{})
+	Errorf(string, ...interface{})
+}
+
+// printfLogger adapts a logger to a leveledLogger by logging all
+// levels with Printf.
+type printfLogger struct {
+	l logger
+}
+
+func (p printfLogger) Debugf(format string, v ...interface{}) { p.l.Printf(format, v...) }
+func (p printfLogger) Infof(format string, v ...interface{})  { p.l.Printf(format, v...) }
+func (p printfLogger) Warnf(format string, v ...interface{})  { p.l.Printf(format, v...) }
+func (p printfLogger) Errorf(format string, v ...interface{}) { p.l.Printf(format, v...) }
+
+// multiLogger is a leveledLogger logging to each of its loggers.
+type multiLogger []leveledLogger
+
+func (m multiLogger) Debugf(format string, v ...interface{}) {
+	for _, l := range m {
+		l.Debugf(format, v...)
+	}
+}
+
+func (m multiLogger) Infof(format string, v ...interface{}) {
+	for _, l := range m {
+		l.Infof(format, v...)
+	}
+}
+
+func (m multiLogger) Warnf(format string, v ...interface{}) {
+	for _, l := range m {
+		l.Warnf(format, v...)
+	}
+}
+
+func (m multiLogger) Errorf(format string, v ...interface{}) {
+	for _, l := range m {
+		l.Errorf(format, v...)
+	}
+}
+
 type nopLogger struct{}
 
-func (l *nopLogger) Printf(format string, v ...interface{}) {}
+func (l *nopLogger) Debugf(format string, v ...interface{}) {}
+func (l *nopLogger) Infof(format string, v ...interface{})  {}
+func (l *nopLogger) Warnf(format string, v ...interface{})  {}
+func (l *nopLogger) Errorf(format string, v ...interface{}) {}
 
 // New creates a new certMan. The certFile and the keyFile
 // are both paths to the location of the files. Relative and
-// absolute paths are accepted.
+// absolute paths are accepted. Relative paths are resolved
+// against the working directory when New is called unless
+// SetRelativePaths is used.
 func New(certFile, keyFile string) (*CertMan, error) {
-	var err error
-
-	certFile, err = filepath.Abs(certFile)
+	certAbs, err := filepath.Abs(certFile)
 	if err != nil {
 		return nil, err
 	}
 
-	keyFile, err = filepath.Abs(keyFile)
+	keyAbs, err := filepath.Abs(keyFile)
 	if err != nil {
 		return nil, err
 	}
 
-	cm := &CertMan{
+	cm := newCertMan()
+	cm.certFile = certAbs
+	cm.keyFile = keyAbs
+	cm.certPath = certFile
+	cm.keyPath = keyFile
+
+	return cm, nil
+}
+
+// newCertMan returns a certMan with the default settings.
+func newCertMan() *CertMan {
+	return &CertMan{
 		mu:       sync.RWMutex{},
-		certFile: certFile,
-		keyFile:  keyFile,
+		marker:   defaultMarker,
+		coalesce: defaultCoalesceWindow,
+		settle:   defaultSettleDelay,
+		retry:    defaultRewatchDelay,
+		now:      time.Now,
 		log:      &nopLogger{},
+		metrics:  nopMetrics{},
+		done:     make(chan struct{}),
+		quit:     make(chan struct{}),
+		restart:  make(chan chan error),
 	}
-
-	return cm, nil
 }
 
 // Logger sets the logger for certMan to use. It accepts
-// a logger interface.
+// a logger interface. It is safe to call while watching.
 func (cm *CertMan) Logger(logger logger) {
+	cm.LeveledLogger(printfLogger{logger})
+}
+
+// LeveledLogger sets a logger with levels for certMan to use
+// in place of one set by Logger. It accepts a leveledLogger
+// interface. It is safe to call while watching.
+func (cm *CertMan) LeveledLogger(logger leveledLogger) {
+	cm.mu.Lock()
 	cm.log = logger
+	cm.mu.Unlock()
+}
+
+// AddLogger adds a logger for certMan to log to alongside those
+// already set. It accepts a logger interface. It is safe to call
+// while watching.
+func (cm *CertMan) AddLogger(logger logger) {
+	cm.AddLeveledLogger(printfLogger{logger})
+}
+
+// AddLeveledLogger adds a logger with levels for certMan to log to
+// alongside those already set. It accepts a leveledLogger interface.
+// It is safe to call while watching.
+func (cm *CertMan) AddLeveledLogger(logger leveledLogger) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	switch l := cm.log.(type) {
+	case *nopLogger:
+		cm.log = logger
+	case multiLogger:
+		cm.log = append(append(multiLogger{}, l...), logger)
+	default:
+		cm.log = multiLogger{l, logger}
+	}
+}
+
+// logger returns the logger to use. It must not be called with cm.mu
+// held.
+func (cm *CertMan) logger() leveledLogger {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.log
+}
+
+// SetRelativePaths sets whether relative certificate and key paths
+// passed to New are kept relative and resolved against the working
+// directory at each load, rather than made absolute by New. This is
+// for processes that change directory or chroot after startup and
+// must be called before Watch.
+func (cm *CertMan) SetRelativePaths(relative bool) {
+	cm.mu.Lock()
+	cm.relative = relative
+	cm.mu.Unlock()
+}
+
+// files returns the certificate and key paths to load and watch.
+func (cm *CertMan) files() (certFile, keyFile string) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.relative {
+		return cm.certPath, cm.keyPath
+	}
+
+	return cm.certFile, cm.keyFile
+}
+
+// SetProjectionMarker sets the path, relative to the directories
+// holding the certificate and key files and starting with a slash, of
+// the symlink whose creation or renaming into place signals that the
+// secret store has atomically swapped the directory holding the files.
+// The files are then reopened by their paths so the symlinks are
+// resolved afresh. It defaults to "/..data", the symlink used by
+// Kubernetes. An empty path disables the check so only changes to
+// the files themselves trigger a reload.
+func (cm *CertMan) SetProjectionMarker(suffix string) {
+	cm.mu.Lock()
+	cm.marker = suffix
+	cm.mu.Unlock()
 }
 
 // Watch starts watching for changes to the certificate
@@ -77,78 +332,796 @@ func (cm *CertMan) Logger(logger logger) {
 // are reloaded. If there is an issue the load will fail
 // and the old (if any) certificates and keys will continue
 // to be used.
+//
+// The directories containing the files are watched rather than
+// the files themselves so that files replaced by a rename, by a
+// hardlink created over their path or by a secret store swapping a
+// symlinked directory are still seen.
 func (cm *CertMan) Watch() error {
-	var err error
+	if cm.source != nil {
+		return cm.watchSource()
+	}
 
-	if cm.watcher, err = fsnotify.NewWatcher(); err != nil {
-		return errors.Wrap(err, "can't create watcher")
+	if cm.fsys != nil {
+		return errWatchFS
 	}
 
-	if err = cm.watcher.Add(cm.certFile); err != nil {
-		return errors.Wrap(err, "can't watch cert file")
+	if err := cm.refuseKeyPermissions(); err != nil {
+		return err
 	}
 
-	if err = cm.watcher.Add(cm.keyFile); err != nil {
-		return errors.Wrap(err, "can't watch key file")
+	watcher, err := cm.startWatcher()
+	if err != nil {
+		return err
+	}
+
+	cm.mu.RLock()
+	strict := cm.strictLoad
+	cm.mu.RUnlock()
+
+	if strict {
+		if err := cm.preflight(); err != nil {
+			watcher.Close()
+			return err
+		}
 	}
 
-	if err := cm.load(); err != nil {
-		cm.log.Printf("can't load cert or key file: %v", err)
+	if err := cm.reload(); err != nil && strict {
+		watcher.Close()
+		return err
 	}
+	cm.loadPairs(nil)
 
-	cm.log.Printf("watching for cert and key change")
+	cm.logger().Infof("watching for cert and key change")
+	cm.emit(sinkWatchStarted, "", nil, nil)
 
+	cm.mu.Lock()
+	cm.watcher = watcher
 	cm.watching = make(chan bool)
+	select {
+	case <-cm.done:
+		cm.done = make(chan struct{})
+	default:
+	}
+	done := cm.done
+	cm.renewQuit()
+	cm.mu.Unlock()
 
-	go cm.run()
+	cm.startUptime()
+	go cm.run(done)
 
 	return nil
 }
 
+// startWatcher returns a new watcher once the certificate and key
+// files exist, retrying permission errors as set by SetWatchRetry.
+func (cm *CertMan) startWatcher() (*fsnotify.Watcher, error) {
+	start := time.Now()
+
+	for {
+		watcher, err := cm.tryWatcher()
+		if err == nil {
+			return watcher, nil
+		}
+
+		cm.mu.RLock()
+		interval, deadline := cm.permRetry, cm.permDeadline
+		cm.mu.RUnlock()
+
+		if interval <= 0 || !errors.Is(err, fs.ErrPermission) {
+			return nil, err
+		}
+
+		if time.Since(start)+interval > deadline {
+			return nil, errors.Wrapf(err, "gave up watching after %v", deadline)
+		}
+
+		cm.logger().Warnf("%v, retrying in %v", err, interval)
+		time.Sleep(interval)
+	}
+}
+
+// tryWatcher returns a new watcher if the certificate and key files
+// exist.
+func (cm *CertMan) tryWatcher() (*fsnotify.Watcher, error) {
+	certFile, keyFile := cm.files()
+
+	if _, err := os.Stat(certFile); err != nil {
+		return nil, errors.Wrap(err, "can't watch cert file")
+	}
+
+	if _, err := os.Stat(keyFile); err != nil {
+		return nil, errors.Wrap(err, "can't watch key file")
+	}
+
+	return cm.newWatcher()
+}
+
+// newWatcher returns a watcher watching the directories of the
+// certificate and key files, any recursively watched subdirectories
+// and the directories of the other watched files.
+func (cm *CertMan) newWatcher() (*fsnotify.Watcher, error) {
+	certFile, keyFile := cm.files()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create watcher")
+	}
+
+	certDir := filepath.Dir(certFile)
+	keyDir := filepath.Dir(keyFile)
+
+	if cm.watchingFiles() {
+		if err = cm.watchFiles(watcher); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	} else {
+		if err = addWatch(watcher, certDir); err != nil {
+			watcher.Close()
+			return nil, errors.Wrap(err, "can't watch cert file")
+		}
+
+		if keyDir != certDir {
+			if err = addWatch(watcher, keyDir); err != nil {
+				watcher.Close()
+				return nil, errors.Wrap(err, "can't watch key file")
+			}
+		}
+	}
+
+	if err = cm.watchTrees(watcher); err != nil {
+		watcher.Close()
+		return nil, errors.Wrap(err, "can't watch subdirectories")
+	}
+
+	for _, w := range cm.watchedFiles() {
+		if err = addWatch(watcher, filepath.Dir(w.file)); err != nil {
+			watcher.Close()
+			return nil, errors.Wrapf(err, "can't watch %s file", w.kind)
+		}
+	}
+
+	cm.mu.RLock()
+	interDir := cm.interDir
+	cm.mu.RUnlock()
+
+	if interDir != "" {
+		if err = addWatch(watcher, interDir); err != nil {
+			watcher.Close()
+			return nil, errors.Wrap(err, "can't watch intermediates")
+		}
+	}
+
+	return watcher, nil
+}
+
+// currentWatcher returns the watcher in use, or nil if Watch hasn't been
+// called.
+func (cm *CertMan) currentWatcher() *fsnotify.Watcher {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.watcher
+}
+
+// A watchedFile is a file other than the certificate and key files
+// passed to New that is watched for changes.
+type watchedFile struct {
+	kind string
+	file string
+}
+
+// watchedFiles returns the files other than the certificate and
+// key files passed to New that are watched for changes.
+func (cm *CertMan) watchedFiles() []watchedFile {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	var files []watchedFile
+
+	if cm.policyFile != "" {
+		files = append(files, watchedFile{"policy", cm.policyFile})
+	}
+
+	if cm.ocspFile != "" {
+		files = append(files, watchedFile{"ocsp", cm.ocspFile})
+	}
+
+	if cm.manifest != "" {
+		files = append(files, watchedFile{"manifest", cm.manifest})
+	}
+
+	for _, p := range cm.pairs {
+		files = append(files, watchedFile{"cert", p.certFile}, watchedFile{"key", p.keyFile})
+	}
+
+	if cm.passFile != "" {
+		files = append(files, watchedFile{"passphrase", cm.passFile})
+	}
+
+	for _, path := range cm.additional {
+		files = append(files, watchedFile{"additional", path})
+	}
+
+	return files
+}
+
 func (cm *CertMan) load() error {
-	keyPair, err := tls.LoadX509KeyPair(cm.certFile, cm.keyFile)
-	if err == nil {
-		cm.mu.Lock()
-		cm.keyPair = &keyPair
-		cm.mu.Unlock()
-		cm.log.Printf("certificate and key loaded")
+	var keyPair *tls.Certificate
+	var err error
+	switch {
+	case cm.source != nil:
+		keyPair, err = cm.loadSource()
+	case cm.fsys != nil:
+		keyPair, err = cm.loadFS()
+	case cm.keySource != nil:
+		keyPair, err = cm.loadKeySource()
+	default:
+		keyPair, err = cm.loadFiles()
+	}
+	if err != nil {
+		return err
+	}
+
+	cm.mu.RLock()
+	old := cm.keyPair
+	cm.mu.RUnlock()
+
+	if err := cm.checkLoaded(old, keyPair); err != nil {
+		return err
+	}
+
+	certFile, _ := cm.files()
+	cm.warnCommonName(certFile, keyPair)
+
+	cm.mu.RLock()
+	ocspFile := cm.ocspFile
+	cm.mu.RUnlock()
+
+	var stapleErr error
+	if ocspFile != "" {
+		keyPair.OCSPStaple, stapleErr = readStaple(ocspFile, keyPair)
+	}
+
+	cm.mu.Lock()
+	held := cm.hold(keyPair)
+	servableFrom := cm.servableFrom(keyPair)
+	prev := cm.keyPair
+	if !held {
+		cm.setKeyPair(keyPair)
+	}
+	opened := cm.gated && !cm.validated && cm.validator != nil
+	cm.validated = cm.validator != nil
+	cm.storeSnapshot()
+	cm.mu.Unlock()
+
+	if held {
+		cm.logger().Infof("certificate and key loaded, not served until %v so serving previous certificate", servableFrom)
+	} else {
+		cm.logger().Infof("certificate and key loaded")
+		cm.logRotation(cm.certName(), prev, keyPair)
+	}
+
+	if opened {
+		cm.logger().Infof("certificate passed validation, serving enabled")
 	}
 
-	return err
+	if stapleErr != nil {
+		cm.logger().Warnf("can't load ocsp file: %v", stapleErr)
+	}
+
+	return nil
 }
 
-func (cm *CertMan) run() {
+// checkLoaded runs the checks keyPair must pass to replace old, the
+// certificate loaded before it, which may be nil.
+func (cm *CertMan) checkLoaded(old, keyPair *tls.Certificate) error {
+	if err := cm.checkKeyRotation(old, keyPair); err != nil {
+		return err
+	}
+
+	return cm.checkPins(keyPair)
+}
+
+// loadFiles loads the certificate and key files.
+func (cm *CertMan) loadFiles() (*tls.Certificate, error) {
+	certFile, keyFile := cm.files()
+
+	if err := cm.checkKeyPermissions(keyFile); err != nil {
+		return nil, err
+	}
+
+	return cm.loadKeyPair(certFile, keyFile)
+}
+
+// setKeyPair makes keyPair the served certificate. cm.mu must be held
+// for writing.
+func (cm *CertMan) setKeyPair(keyPair *tls.Certificate) {
+	cm.keyPair = keyPair
+	cm.info = certInfo(keyPair)
+	cm.stapleNext = stapleNextUpdate(keyPair.OCSPStaple)
+	cm.buildChains()
+	cm.indexNames()
+
+	for _, c := range cm.reloaded {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (cm *CertMan) run(done chan struct{}) {
+	defer func() { cm.watchStopped(recover()) }()
+	defer close(done)
+	defer cm.stopUptime()
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	var pending <-chan time.Time
+	b := &batch{}
+
+	watcher := cm.currentWatcher()
+
+	retry := time.NewTimer(time.Hour)
+	retry.Stop()
+
+	// Cleaned up on the way out even if the goroutine panics, so the
+	// callbacks registered with OnWatchStopped may call Watch.
+	defer func() {
+		timer.Stop()
+		retry.Stop()
+		watcher.Close()
+		cm.setReloadAt(time.Time{})
+	}()
+
+	var retrying <-chan time.Time
+	remounting := false
+
+	var beat <-chan time.Time
+	ticker, beatMsg := cm.heartbeatTicker()
+	if ticker != nil {
+		defer ticker.Stop()
+		beat = ticker.C
+	}
+
+	// The close watch is set up again whenever the watcher is, as a
+	// directory removed or unmounted takes its watch with it.
+	closed, stopClosed := cm.closeWrites()
+	defer func() { stopClosed() }()
+
+	rearmClosed := func() {
+		stopClosed()
+		closed, stopClosed = cm.closeWrites()
+	}
+
+	var safety <-chan time.Time
+	var hash [sha256.Size]byte
+	if ticker := cm.safetyTicker(); ticker != nil {
+		defer ticker.Stop()
+		safety = ticker.C
+		hash = cm.filesHash()
+	}
+
+	// rehash records the files' contents once loaded after an event,
+	// so the safety check doesn't reload them again. Contents that
+	// failed to load, err being the failure, aren't recorded, so the
+	// safety check tries them again.
+	rehash := func(err error) {
+		if safety != nil && err == nil {
+			hash = cm.filesHash()
+		}
+	}
+
+	rewatch := func() {
+		var w *fsnotify.Watcher
+		var err error
+		if remounting {
+			err = cm.remounted()
+		}
+		if err == nil {
+			w, err = cm.replaceWatcher(watcher)
+		}
+		if err != nil {
+			cm.mu.RLock()
+			delay := cm.retry
+			cm.mu.RUnlock()
+
+			cm.setLastError(err)
+			cm.logger().Errorf("can't re-establish watch, retrying in %v: %v", delay, err)
+			cm.emit(sinkWatchError, "", nil, err)
+			retry.Reset(delay)
+			retrying = retry.C
+			return
+		}
+		watcher = w
+		retrying = nil
+		rearmClosed()
+		rehash(cm.LastError())
+
+		if remounting {
+			remounting = false
+			cm.logger().Infof("watch re-established after remount")
+		} else {
+			cm.logger().Infof("watch re-established")
+		}
+		cm.publish(Event{Type: EventRecovered})
+		cm.watchRecovered()
+	}
+
+	schedule := func(d time.Duration) {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(d)
+		pending = timer.C
+		cm.setReloadAt(time.Now().Add(d))
+	}
+
 loop:
 	for {
 		select {
 		case <-cm.watching:
 			break loop
-		case event := <-cm.watcher.Events:
-			cm.log.Printf("watch event: %v", event)
-			if err := cm.load(); err != nil {
-				cm.log.Printf("can't load cert or key file: %v", err)
+		case <-pending:
+			pending = nil
+			cm.setReloadAt(time.Time{})
+			if d := cm.wait(b); d > 0 {
+				schedule(d)
+				continue
+			}
+			var err error
+			certFile, keyFile := cm.files()
+			if b.all || b.has(certFile) || b.has(keyFile) {
+				err = cm.reloadFor(b.last)
+				if cm.watchingFiles() {
+					if err := cm.watchFiles(watcher); err != nil {
+						cm.logger().Warnf("%v", err)
+					}
+				}
+			}
+			cm.loadPairs(b)
+			b = &batch{}
+			rehash(err)
+		case <-retrying:
+			rewatch()
+		case <-beat:
+			cm.logger().Infof("%s", beatMsg)
+		case <-safety:
+			if h := cm.filesHash(); h != hash {
+				cm.logger().Infof("files changed without a watch event, reloading")
+				if cm.reload() == nil {
+					hash = h
+				}
+				cm.loadPairs(nil)
+			}
+		case name, ok := <-closed:
+			if !ok {
+				closed = nil
+				cm.logger().Warnf("stopped watching for files closed after writing, reloading once writes pause")
+				continue
+			}
+			event := fsnotify.Event{Name: name, Op: fsnotify.Write}
+			if cm.relevant(event) {
+				cm.logger().Debugf("closed after writing: %s", name)
+				cm.emit(sinkWatchEvent, name, nil, nil)
+				b.add(event, false)
+
+				cm.mu.RLock()
+				coalesce := cm.coalesce
+				cm.mu.RUnlock()
+
+				schedule(coalesce)
+			}
+		case reply := <-cm.restart:
+			w, err := cm.restartWatcher(watcher)
+			if err == nil {
+				watcher = w
+				retrying = nil
+				remounting = false
+				rearmClosed()
+				rehash(nil)
+				cm.logger().Infof("watch restarted")
+			}
+			reply <- err
+		case event := <-watcher.Events:
+			if path := cm.removedFile(event); path != "" {
+				cm.logger().Warnf("watched file %s removed", path)
+				cm.fileRemoved(path)
+			}
+
+			if retrying == nil && cm.watchedDirRemoved(event) {
+				cm.logger().Warnf("watched directory %s removed", event.Name)
+				rewatch()
+				continue
+			}
+
+			if retrying == nil && cm.watchedDirUnmounted(event) {
+				cm.logger().Warnf("watched directory %s unmounted", event.Name)
+				remounting = true
+				rewatch()
+				continue
+			}
+
+			// Writes in place are loaded once the file is closed.
+			if closed != nil && event.Op == fsnotify.Write && cm.relevant(event) {
+				cm.logEvent(event)
+				continue
+			}
+
+			cm.mu.RLock()
+			policyFile, ocspFile, manifest := cm.policyFile, cm.ocspFile, cm.manifest
+			passFile := cm.passFile
+			coalesce := cm.coalesce
+			cm.mu.RUnlock()
+
+			switch {
+			case cm.relevant(event), cm.pairEvent(event):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				b.add(event, cm.markerEvent(event))
+				schedule(coalesce)
+			case cm.intermediateEvent(event):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				b.add(event, true)
+				schedule(coalesce)
+			case cm.treeEvent(event):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				b.add(event, true)
+				schedule(coalesce)
+			case sameFile(event.Name, policyFile):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				if err := cm.loadPolicy(); err != nil {
+					cm.logger().Errorf("can't load policy file: %v", err)
+				}
+			case sameFile(event.Name, manifest):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				if err := cm.loadManifest(); err != nil {
+					cm.logger().Errorf("can't load manifest file: %v", err)
+				}
+			case sameFile(event.Name, ocspFile):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				if err := cm.loadOCSP(); err != nil {
+					cm.logger().Errorf("can't load ocsp file: %v", err)
+				}
+			case sameFile(event.Name, passFile):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				b.add(event, true)
+				schedule(coalesce)
+			case cm.additionalEvent(event):
+				cm.logEvent(event)
+				cm.emit(sinkWatchEvent, event.Name, nil, nil)
+				b.add(event, true)
+				schedule(coalesce)
+			}
+		case err := <-watcher.Errors:
+			cm.setLastError(err)
+			cm.metricsSink().IncError()
+			cm.logger().Errorf("error watching files: %v", err)
+			cm.emit(sinkWatchError, "", nil, err)
+			if retrying == nil {
+				rewatch()
 			}
-		case err := <-cm.watcher.Errors:
-			cm.log.Printf("error watching files: %v", err)
 		}
 	}
 
-	cm.log.Printf("stopped watching")
+	cm.logger().Infof("stopped watching")
+	cm.emit(sinkWatchStopped, "", nil, nil)
+}
+
+// relevant reports whether event concerns the certificate or key
+// files, or the projection marker of the directory holding them.
+func (cm *CertMan) relevant(event fsnotify.Event) bool {
+	certFile, keyFile := cm.files()
+
+	if sameFile(event.Name, certFile) || sameFile(event.Name, keyFile) {
+		return true
+	}
+
+	return cm.markerEvent(event)
+}
+
+// markerEvent reports whether event is the projection marker being
+// created, or renamed into place, in the directory of the certificate
+// or key file. Kubernetes swaps its ..data symlink by renaming a new
+// one over it, which is seen as a create. Other events, and events for
+// names that merely end with the marker, don't signal a swap.
+func (cm *CertMan) markerEvent(event fsnotify.Event) bool {
+	cm.mu.RLock()
+	marker := cm.marker
+	cm.mu.RUnlock()
+
+	if marker == "" || event.Op&fsnotify.Create == 0 {
+		return false
+	}
+
+	certFile, keyFile := cm.files()
+	name := filepath.Clean(event.Name)
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if equalPath(name, filepath.Join(dir, filepath.FromSlash(marker))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameFile reports whether the name of an event refers to file. Both
+// are cleaned as fsnotify may report a name spelled differently to
+// the path certman was given. Events from a directory watch are named
+// by joining the watched directory with the file's base name, so if
+// the base names match the directories are compared by identity.
+func sameFile(name, file string) bool {
+	if file == "" {
+		return false
+	}
+
+	name, file = filepath.Clean(name), filepath.Clean(file)
+	if equalPath(name, file) {
+		return true
+	}
+
+	if !equalPath(filepath.Base(name), filepath.Base(file)) {
+		return false
+	}
+
+	nameDir, err := os.Stat(filepath.Dir(name))
+	if err != nil {
+		return false
+	}
+
+	fileDir, err := os.Stat(filepath.Dir(file))
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(nameDir, fileDir)
+}
+
+// goSession runs fn in a goroutine, passing it a channel closed when
+// Stop is called, and runs it again each time Watch is called after
+// Stop, so goroutines started by WatchExpiry and the like survive
+// watching being restarted. If watching has stopped fn first runs when
+// Watch is next called.
+func (cm *CertMan) goSession(fn func(quit <-chan struct{})) {
+	cm.mu.Lock()
+	cm.sessions = append(cm.sessions, fn)
+	quit := cm.quit
+	cm.mu.Unlock()
+
+	select {
+	case <-quit:
+	default:
+		go fn(quit)
+	}
+}
+
+// renewQuit replaces the quit channel if Stop closed it, runs the
+// goroutines started by goSession again and re-arms the activation
+// timer of any pending certificate. cm.mu must be held for writing.
+func (cm *CertMan) renewQuit() {
+	select {
+	case <-cm.quit:
+	default:
+		return
+	}
+
+	cm.quit = make(chan struct{})
+	for _, fn := range cm.sessions {
+		go fn(cm.quit)
+	}
+
+	// An activation timer that fired while stopped didn't promote.
+	if cm.pending != nil {
+		if cm.activation != nil {
+			cm.activation.Stop()
+		}
+		cm.activation = time.AfterFunc(cm.servableFrom(cm.pending).Sub(cm.now()), cm.activate)
+	}
+}
+
+// stopping returns the channel closed when Stop is next called.
+func (cm *CertMan) stopping() <-chan struct{} {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 
-	cm.watcher.Close()
+	return cm.quit
 }
 
 // GetCertificate returns the loaded certificate for use by
 // the TLSConfig fields GetCertificate field in a http.Server.
+// If pairs have been added with AddPair the certificate is
+// chosen by the server name the client requested, unless the
+// client's address is mapped to one with MapCIDR or the port it
+// connected to with MapPort, or a selector is set with SetSelector.
+// Once loads have been failing for long enough, a certificate set by
+// SetMaintenanceCertificate is served instead.
+// The certificate returned is the one certMan serves, shared with
+// crypto/tls which treats it as read only; use Snapshot for a copy
+// that may be modified.
 func (cm *CertMan) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cm.promote()
+	cm.dropStaleStaple()
+
+	if keyPair := cm.degraded(); keyPair != nil {
+		return keyPair, nil
+	}
+
+	return cm.serving().serve(hello)
+}
+
+// GetClientCertificate returns the loaded certificate for use by
+// the GetClientCertificate field of a tls.Config used by a client.
+func (cm *CertMan) GetClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cm.promote()
+
+	s := cm.serving()
+
+	return s.servable(s.keyPair)
+}
+
+// GetCertificateFunc returns GetCertificate as a plain function
+// bound to cm for APIs that take a func rather than a method value.
+func (cm *CertMan) GetCertificateFunc() func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cm.GetCertificate(hello)
+	}
+}
+
+// GetClientCertificateFunc returns GetClientCertificate as a plain
+// function bound to cm.
+func (cm *CertMan) GetClientCertificateFunc() func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return cm.GetClientCertificate(info)
+	}
+}
+
+// Done returns a channel that is closed when watching stops, for
+// selecting on alongside other shutdown signals. Before Watch is
+// called it returns the channel for the first watch. Calling Watch
+// again after watching stops starts a new channel.
+func (cm *CertMan) Done() <-chan struct{} {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
-	return cm.keyPair, nil
+	return cm.done
 }
 
 // Stop tells certMan to stop watching for changes to the
-// certificate and key files.
+// certificate and key files. A reload in progress, whether started by
+// a change or by Reload, completes before Stop returns and no further
+// changes are loaded, so the certificate served afterwards is the
+// last one loaded. Stop may be called more than once, and before
+// Watch; it returns without waiting once watching has stopped.
 func (cm *CertMan) Stop() {
-	cm.watching <- false
+	cm.mu.Lock()
+	select {
+	case <-cm.quit:
+	default:
+		close(cm.quit)
+	}
+	watching, done := cm.watching, cm.done
+	cm.mu.Unlock()
+
+	if watching != nil {
+		select {
+		case watching <- false:
+		case <-done:
+		}
+		<-done
+	}
+
+	cm.reloadMu.Lock()
+	cm.reloadMu.Unlock()
 }
@@ -7,19 +7,23 @@ package certman_test
 import (
 	"bytes"
 	"crypto/tls"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
 )
 
 func TestValidPair(t *testing.T) {
-	buf := new(bytes.Buffer)
+	buf := new(syncBuffer)
 	l := log.New(buf, "", 0)
 
 	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
@@ -44,7 +48,7 @@ func TestValidPair(t *testing.T) {
 }
 
 func TestInvalidPair(t *testing.T) {
-	buf := new(bytes.Buffer)
+	buf := new(syncBuffer)
 	l := log.New(buf, "", 0)
 
 	cm, err := certman.New("./testdata/server1.crt", "./testdata/server2.key")
@@ -69,7 +73,7 @@ func TestInvalidPair(t *testing.T) {
 }
 
 func TestCertificateNotFound(t *testing.T) {
-	buf := new(bytes.Buffer)
+	buf := new(syncBuffer)
 	l := log.New(buf, "", 0)
 
 	cm, err := certman.New("./testdata/nothere.crt", "./testdata/server2.key")
@@ -86,7 +90,7 @@ func TestCertificateNotFound(t *testing.T) {
 }
 
 func TestKeyNotFound(t *testing.T) {
-	buf := new(bytes.Buffer)
+	buf := new(syncBuffer)
 	l := log.New(buf, "", 0)
 	cm, err := certman.New("./testdata/server1.crt", "./testdata/nothere.key")
 
@@ -103,12 +107,13 @@ func TestKeyNotFound(t *testing.T) {
 }
 
 func TestValidPairValidPair(t *testing.T) {
-	buf := new(bytes.Buffer)
+	buf := new(syncBuffer)
 	l := log.New(buf, "", 0)
 
-	copyPair("./testdata/server1.crt", "./testdata/server1.key")
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
 
-	cm, err := certman.New("./testdata/server.crt", "./testdata/server.key")
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
 	if err != nil {
 		t.Fatalf("could not create certman: %v", err)
 	}
@@ -129,12 +134,13 @@ func TestValidPairValidPair(t *testing.T) {
 	}
 
 	buf.Reset()
-	copyPair("./testdata/server2.crt", "./testdata/server2.key")
+	copyPair(dir, "./testdata/server2.crt", "./testdata/server2.key")
 
-	time.Sleep(200 * time.Millisecond)
+	waitReload(t, cm)
 
 	logWant = "certificate and key loaded"
-	logGot = strings.Split(buf.String(), "\n")[3]
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	logGot = lines[len(lines)-1]
 
 	if logGot != logWant {
 		t.Log("log output expected:", logWant)
@@ -144,12 +150,13 @@ func TestValidPairValidPair(t *testing.T) {
 }
 
 func TestValidPairInvalidPair(t *testing.T) {
-	buf := new(bytes.Buffer)
+	buf := new(syncBuffer)
 	l := log.New(buf, "", 0)
 
-	copyPair("./testdata/server1.crt", "./testdata/server1.key")
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
 
-	cm, err := certman.New("./testdata/server.crt", "./testdata/server.key")
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
 	if err != nil {
 		t.Fatalf("could not create certman: %v", err)
 	}
@@ -171,12 +178,13 @@ func TestValidPairInvalidPair(t *testing.T) {
 
 	buf.Reset()
 
-	copyPair("./testdata/server1.crt", "./testdata/server2.key")
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
 
 	time.Sleep(200 * time.Millisecond)
 
 	logWant = "can't load cert or key file: tls: private key does not match public key"
-	logGot = strings.Split(buf.String(), "\n")[3]
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	logGot = lines[len(lines)-1]
 
 	if logGot != logWant {
 		t.Log("log output expected:", logWant)
@@ -186,12 +194,13 @@ func TestValidPairInvalidPair(t *testing.T) {
 }
 
 func TestStop(t *testing.T) {
-	buf := new(bytes.Buffer)
+	buf := new(syncBuffer)
 	l := log.New(buf, "", 0)
 
-	copyPair("./testdata/server1.crt", "./testdata/server1.key")
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
 
-	cm, err := certman.New("./testdata/server.crt", "./testdata/server.key")
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
 	if err != nil {
 		t.Fatalf("could not create certman: %v", err)
 	}
@@ -214,7 +223,7 @@ func TestStop(t *testing.T) {
 	buf.Reset()
 	cm.Stop()
 
-	copyPair("./testdata/server2.crt", "./testdata/server2.key")
+	copyPair(dir, "./testdata/server2.crt", "./testdata/server2.key")
 	time.Sleep(200 * time.Millisecond)
 
 	logWant = "stopped watching\n"
@@ -227,6 +236,102 @@ func TestStop(t *testing.T) {
 	}
 }
 
+func TestDone(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	done := cm.Done()
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	select {
+	case <-done:
+		t.Fatalf("done closed while watching")
+	default:
+	}
+
+	cm.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("done not closed after stop")
+	}
+}
+
+func TestStopDuringReload(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetCoalesceWindow(0)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+
+	reloaded := make(chan error)
+	go func() {
+		_, err := cm.Reload()
+		reloaded <- err
+	}()
+
+	cm.Stop()
+
+	if err := <-reloaded; err != nil {
+		t.Fatalf("could not reload: %v", err)
+	}
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after stop, want new.example.com", got)
+	}
+
+	laterCert, laterKey := certmantest.GeneratePair(t, "later.example.com")
+	copyFile(laterCert, certFile)
+	copyFile(laterKey, keyFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after change made once stopped, want new.example.com", got)
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		cm.Stop()
+		if err := cm.Watch(); err != nil {
+			t.Errorf("could not watch files: %v", err)
+			return
+		}
+		cm.Stop()
+		cm.Stop()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop blocked when not watching")
+	}
+}
+
 func TestGetCertificate(t *testing.T) {
 	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
 	if err != nil {
@@ -255,21 +360,441 @@ func TestGetCertificate(t *testing.T) {
 
 }
 
-func copyPair(crt, key string) {
-	// ignore error handling
-	crtSource, _ := os.Open(crt)
-	defer crtSource.Close()
+func TestProjectionMarker(t *testing.T) {
+	for _, marker := range []string{"", "/..data", "/..current"} {
+		dir := t.TempDir()
+		name := "..data"
+		if marker != "" {
+			name = marker[1:]
+		}
+		projectPair(t, dir, name, "..v1", "./testdata/server1.crt", "./testdata/server1.key")
+
+		cm, err := certman.New(dir+"/tls.crt", dir+"/tls.key")
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		if marker != "/..data" {
+			cm.SetProjectionMarker(marker)
+		}
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+
+		projectPair(t, dir, name, "..v2", "./testdata/server2.crt", "./testdata/server2.key")
+
+		time.Sleep(200 * time.Millisecond)
+		cm.Stop()
+
+		want := "./testdata/server2.crt"
+		if marker == "" {
+			want = "./testdata/server1.crt"
+		}
+		if !servedCert(t, cm, want, strings.Replace(want, ".crt", ".key", 1)) {
+			t.Fatalf("marker %q: served certificate is not %s", marker, want)
+		}
+	}
+}
+
+// TestKubernetesSecretUpdates mirrors the events of Kubernetes updating
+// a projected secret: a timestamped directory is written, a ..data_tmp
+// symlink to it is renamed over ..data and the old directory is
+// removed. Each of several rotations must be loaded.
+func TestKubernetesSecretUpdates(t *testing.T) {
+	dir := t.TempDir()
+	projectPair(t, dir, "..data", "..2017_01_01_00_00_00.0", "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(dir+"/tls.crt", dir+"/tls.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	old := "..2017_01_01_00_00_00.0"
+	for i, want := range []string{"server2", "server1", "server2"} {
+		version := fmt.Sprintf("..2017_01_01_00_00_0%d.0", i+1)
+		projectPair(t, dir, "..data", version, "./testdata/"+want+".crt", "./testdata/"+want+".key")
+		if err := os.RemoveAll(filepath.Join(dir, old)); err != nil {
+			t.Fatal(err)
+		}
+		old = version
+		waitReload(t, cm)
+
+		if !servedCert(t, cm, "./testdata/"+want+".crt", "./testdata/"+want+".key") {
+			t.Fatalf("rotation %d: served certificate is not %s", i+1, want)
+		}
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	before, after := t.TempDir(), t.TempDir()
+	copyFile("./testdata/server1.crt", filepath.Join(before, "tls.crt"))
+	copyFile("./testdata/server1.key", filepath.Join(before, "tls.key"))
+	copyFile("./testdata/server2.crt", filepath.Join(after, "tls.crt"))
+	copyFile("./testdata/server2.key", filepath.Join(after, "tls.key"))
+
+	for _, relative := range []bool{false, true} {
+		os.Chdir(before)
+
+		cm, err := certman.New("tls.crt", "tls.key")
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+		cm.SetRelativePaths(relative)
+
+		os.Chdir(after)
+
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		cm.Stop()
+
+		os.Chdir(wd)
+
+		want := "./testdata/server1"
+		if relative {
+			want = "./testdata/server2"
+		}
+		if !servedCert(t, cm, want+".crt", want+".key") {
+			t.Fatalf("relative %v: served certificate is not %s.crt", relative, want)
+		}
+	}
+}
+
+func TestUncleanRelativePaths(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Rel(wd, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(dir+"//server.crt", dir+"/./server.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+	cm.SetRelativePaths(true)
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	copyPair(dir, "./testdata/server2.crt", "./testdata/server2.key")
+	waitReload(t, cm)
+
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("certificate not reloaded")
+	}
+}
+
+// servedCert reports whether cm is serving the given pair.
+func TestHardlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// Each file is replaced by removing it and hardlinking a new file
+	// staged elsewhere over its path, as ln -f does.
+	staging := filepath.Join(dir, "staging")
+	if err := os.Mkdir(staging, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range [][2]string{{"./testdata/server2.crt", crt}, {"./testdata/server2.key", key}} {
+		staged := filepath.Join(staging, filepath.Base(f[1]))
+		copyFile(f[0], staged)
+		if err := os.Remove(f[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(staged, f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitReload(t, cm)
+
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("hardlinked pair not loaded")
+	}
+
+	// Each file is replaced by hardlinking a new file beside it and
+	// renaming the link over its path.
+	os.Remove(filepath.Join(staging, "tls.crt"))
+	os.Remove(filepath.Join(staging, "tls.key"))
+	for _, f := range [][2]string{{"./testdata/server1.crt", crt}, {"./testdata/server1.key", key}} {
+		staged := filepath.Join(staging, filepath.Base(f[1]))
+		copyFile(f[0], staged)
+		if err := os.Link(staged, f[1]+".new"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(f[1]+".new", f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitReload(t, cm)
+
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("pair hardlinked by rename not loaded")
+	}
+}
+
+func servedCert(t *testing.T, cm *certman.CertMan, crt, key string) bool {
+	cmCert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cmCert == nil {
+		t.Fatalf("could not get certman certificate: %v", err)
+	}
+
+	expectedCert, err := tls.LoadX509KeyPair(crt, key)
+	if err != nil {
+		t.Fatalf("could not load certificate and key files to test: %v", err)
+	}
+
+	return reflect.DeepEqual(cmCert.Certificate, expectedCert.Certificate)
+}
+
+// projectPair lays out crt and key in dir the way Kubernetes projects
+// a secret volume: the files are symlinks through a marker symlink to
+// a versioned directory, and updates swap the marker atomically.
+func projectPair(t *testing.T, dir, marker, version, crt, key string) {
+	if err := os.Mkdir(filepath.Join(dir, version), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	copyFile(crt, filepath.Join(dir, version, "tls.crt"))
+	copyFile(key, filepath.Join(dir, version, "tls.key"))
+
+	tmp := filepath.Join(dir, marker+"_tmp")
+	if err := os.Symlink(version, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, marker)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"tls.crt", "tls.key"} {
+		os.Symlink(filepath.Join(marker, f), filepath.Join(dir, f))
+	}
+}
+
+func TestGetCertificateFunc(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	want, _ := cm.GetCertificate(&tls.ClientHelloInfo{})
+
+	got, err := cm.GetCertificateFunc()(&tls.ClientHelloInfo{})
+	if err != nil || got != want {
+		t.Fatalf("GetCertificateFunc returned %v, %v; want %v", got, err, want)
+	}
+
+	got, err = cm.GetClientCertificateFunc()(&tls.CertificateRequestInfo{})
+	if err != nil || got != want {
+		t.Fatalf("GetClientCertificateFunc returned %v, %v; want %v", got, err, want)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for certman to log to while
+// tests read it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	b.buf.Reset()
+	b.mu.Unlock()
+}
+
+type levelLogger struct {
+	buf *syncBuffer
+}
+
+func (l levelLogger) Debugf(f string, v ...interface{}) { fmt.Fprintf(l.buf, "DEBUG "+f+"\n", v...) }
+func (l levelLogger) Infof(f string, v ...interface{})  { fmt.Fprintf(l.buf, "INFO "+f+"\n", v...) }
+func (l levelLogger) Warnf(f string, v ...interface{})  { fmt.Fprintf(l.buf, "WARN "+f+"\n", v...) }
+func (l levelLogger) Errorf(f string, v ...interface{}) { fmt.Fprintf(l.buf, "ERROR "+f+"\n", v...) }
+
+func TestLeveledLogger(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
 
-	crtDest, _ := os.Create("./testdata/server.crt")
-	defer crtDest.Close()
+	cm.LeveledLogger(levelLogger{buf})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	logWant := "INFO certificate and key loaded\n" +
+		"INFO watching for cert and key change\n"
+	logGot := buf.String()
+
+	if logGot != logWant {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", logGot)
+		t.Fatalf("log from certman not as expected")
+	}
 
-	io.Copy(crtDest, crtSource)
+	buf.Reset()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
+	time.Sleep(200 * time.Millisecond)
+	cm.Stop()
+	time.Sleep(50 * time.Millisecond)
 
-	keySource, _ := os.Open(key)
-	defer keySource.Close()
+	for _, line := range []string{"DEBUG watch event", "ERROR can't load cert or key file", "INFO stopped watching"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("log from certman doesn't contain %q", line)
+		}
+	}
+}
+
+func TestAddLogger(t *testing.T) {
+	plain, leveled := new(syncBuffer), new(syncBuffer)
+
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.AddLogger(log.New(plain, "", 0))
+	cm.AddLeveledLogger(levelLogger{leveled})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	cm.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	logWant := "certificate and key loaded\n" +
+		"watching for cert and key change\n" +
+		"stopped watching\n"
+	if plain.String() != logWant {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", plain.String())
+		t.Fatalf("log from certman not as expected")
+	}
+
+	logWant = "INFO certificate and key loaded\n" +
+		"INFO watching for cert and key change\n" +
+		"INFO stopped watching\n"
+	if leveled.String() != logWant {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", leveled.String())
+		t.Fatalf("log from certman not as expected")
+	}
+}
+
+func TestSwapLoggerWhileWatching(t *testing.T) {
+	before, after := new(syncBuffer), new(syncBuffer)
+
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(log.New(before, "", 0))
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cm.Logger(log.New(before, "", 0))
+			cm.LeveledLogger(levelLogger{before})
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		copyPair(dir, "./testdata/server2.crt", "./testdata/server2.key")
+		copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+	}
+	wg.Wait()
+
+	cm.LeveledLogger(levelLogger{after})
+	time.Sleep(200 * time.Millisecond)
+	copyPair(dir, "./testdata/server2.crt", "./testdata/server2.key")
+	waitReload(t, cm)
+
+	logWant := "INFO certificate and key loaded"
+	if !strings.Contains(after.String(), logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", after.String())
+		t.Fatalf("log from certman not as expected")
+	}
+}
+
+// copyPair copies crt and key to server.crt and server.key in dir.
+func copyPair(dir, crt, key string) {
+	copyFile(crt, filepath.Join(dir, "server.crt"))
+	copyFile(key, filepath.Join(dir, "server.key"))
+}
+
+// copyFile replaces dest with a copy of source by renaming a
+// temporary file over it so dest is never seen partially written.
+func copyFile(source, dest string) {
+	// ignore error handling
+	src, _ := os.Open(source)
+	defer src.Close()
 
-	keyDest, _ := os.Create("./testdata/server.key")
-	defer keyDest.Close()
+	tmp, _ := os.Create(dest + ".tmp")
+	io.Copy(tmp, src)
+	tmp.Close()
 
-	io.Copy(keyDest, keySource)
+	os.Rename(dest+".tmp", dest)
 }
@@ -0,0 +1,177 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// Package certmank8s provides live reloading of a certificate and key
+// held in a Kubernetes TLS Secret, for clusters where the Secret isn't
+// mounted as a volume for certman to watch. It is a separate module so
+// the certman package doesn't depend on client-go.
+package certmank8s
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// A SecretMan loads and watches a Kubernetes TLS Secret.
+type SecretMan struct {
+	mu        sync.RWMutex
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	keyPair   *tls.Certificate
+	timeout   time.Duration
+	stop      chan struct{}
+	stopOnce  sync.Once
+	log       logger
+}
+
+// defaultSyncTimeout is how long Watch waits for the first sync by
+// default.
+const defaultSyncTimeout = 30 * time.Second
+
+// logger is an interface that wraps the basic Printf method.
+type logger interface {
+	Printf(string, ...interface{})
+}
+
+type nopLogger struct{}
+
+func (l *nopLogger) Printf(format string, v ...interface{}) {}
+
+// New creates a new SecretMan serving the tls.crt and tls.key entries
+// of the Secret called name in namespace, read using client.
+func New(client kubernetes.Interface, namespace, name string) *SecretMan {
+	return &SecretMan{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		timeout:   defaultSyncTimeout,
+		stop:      make(chan struct{}),
+		log:       &nopLogger{},
+	}
+}
+
+// Logger sets the logger for SecretMan to use. It accepts a logger
+// interface.
+func (sm *SecretMan) Logger(logger logger) {
+	sm.mu.Lock()
+	sm.log = logger
+	sm.mu.Unlock()
+}
+
+// SetSyncTimeout sets how long Watch waits for the first sync of the
+// Secret, such as while the API server is unreachable, before giving
+// up. The default is 30 seconds.
+func (sm *SecretMan) SetSyncTimeout(d time.Duration) {
+	sm.mu.Lock()
+	sm.timeout = d
+	sm.mu.Unlock()
+}
+
+func (sm *SecretMan) logger() logger {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.log
+}
+
+// Watch starts an informer watching the Secret and waits for its
+// first sync. On any change the certificate and key are reloaded. If
+// there is an issue the load will fail and the old (if any)
+// certificate and key will continue to be used, including when the
+// Secret is deleted. If the first sync doesn't complete within the
+// timeout set by SetSyncTimeout, or Stop is called first, the informer
+// is shut down, the SecretMan is stopped and an error is returned.
+func (sm *SecretMan) Watch() error {
+	factory := informers.NewSharedInformerFactoryWithOptions(sm.client, 0,
+		informers.WithNamespace(sm.namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", sm.name).String()
+		}),
+	)
+
+	informer := factory.Core().V1().Secrets().Informer()
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: sm.load,
+		UpdateFunc: func(_, obj interface{}) {
+			sm.load(obj)
+		},
+		DeleteFunc: func(interface{}) {
+			sm.logger().Printf("secret %s/%s deleted, serving previous certificate", sm.namespace, sm.name)
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't watch secret")
+	}
+
+	sm.mu.RLock()
+	timeout := sm.timeout
+	sm.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-sm.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	factory.Start(sm.stop)
+	if !cache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
+		sm.Stop()
+		factory.Shutdown()
+		return errors.Errorf("can't sync secret informer within %v", timeout)
+	}
+
+	sm.logger().Printf("watching for secret %s/%s change", sm.namespace, sm.name)
+
+	return nil
+}
+
+func (sm *SecretMan) load(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+
+	keyPair, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		sm.logger().Printf("can't load cert or key from secret %s/%s: %v", sm.namespace, sm.name, err)
+		return
+	}
+
+	sm.mu.Lock()
+	sm.keyPair = &keyPair
+	sm.mu.Unlock()
+
+	sm.logger().Printf("certificate and key loaded from secret %s/%s", sm.namespace, sm.name)
+}
+
+// GetCertificate returns the loaded certificate for use by
+// the TLSConfig fields GetCertificate field in a http.Server.
+func (sm *SecretMan) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.keyPair, nil
+}
+
+// Stop tells SecretMan to stop watching for changes to the Secret.
+func (sm *SecretMan) Stop() {
+	sm.stopOnce.Do(func() {
+		close(sm.stop)
+	})
+}
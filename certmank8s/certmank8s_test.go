@@ -0,0 +1,152 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certmank8s_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman/certmank8s"
+	"github.com/dyson/certman/certmantest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWatchSecret(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	client := fake.NewSimpleClientset(tlsSecret(t, "old.example.com"))
+
+	sm := certmank8s.New(client, "default", "tls")
+	sm.Logger(l)
+	if err := sm.Watch(); err != nil {
+		t.Fatalf("could not watch secret: %v", err)
+	}
+	defer sm.Stop()
+
+	if got := servedName(t, sm); got != "old.example.com" {
+		t.Fatalf("served %q, want %q", got, "old.example.com")
+	}
+
+	secrets := client.CoreV1().Secrets("default")
+	if _, err := secrets.Update(context.Background(), tlsSecret(t, "new.example.com"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return servedName(t, sm) == "new.example.com" })
+
+	invalid := tlsSecret(t, "invalid.example.com")
+	invalid.Data[corev1.TLSPrivateKeyKey] = tlsSecret(t, "other.example.com").Data[corev1.TLSPrivateKeyKey]
+	if _, err := secrets.Update(context.Background(), invalid, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return strings.Contains(buf.String(), "can't load cert or key from secret default/tls") })
+
+	if got := servedName(t, sm); got != "new.example.com" {
+		t.Fatalf("invalid secret replaced the previous certificate, served %q", got)
+	}
+}
+
+func TestWatchSyncTimeout(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("api server unreachable")
+	})
+
+	sm := certmank8s.New(client, "default", "tls")
+	sm.SetSyncTimeout(100 * time.Millisecond)
+
+	watched := make(chan error, 1)
+	go func() { watched <- sm.Watch() }()
+
+	select {
+	case err := <-watched:
+		if err == nil || !strings.Contains(err.Error(), "can't sync secret informer") {
+			t.Fatalf("unexpected error from unsynced watch: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch waited for a sync that can't complete")
+	}
+}
+
+func tlsSecret(t *testing.T, host string) *corev1.Secret {
+	crt, key := certmantest.GeneratePair(t, host)
+
+	crtPEM, err := os.ReadFile(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tls"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       crtPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+}
+
+func servedName(t *testing.T, sm *certmank8s.SecretMan) string {
+	cert, err := sm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cert == nil {
+		t.Fatalf("could not get certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.DNSNames[0]
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 50; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("condition not met")
+}
+
+// syncBuffer is a bytes.Buffer safe for the informer to log to while
+// tests read it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
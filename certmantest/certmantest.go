@@ -0,0 +1,129 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// Package certmantest provides utilities for testing code that uses
+// certman. It generates ephemeral self-signed certificate and key
+// pairs so tests don't need to commit certificates to testdata.
+//
+// Expired and not yet valid pairs for negative tests are generated by
+// GenerateExpiredPair and GenerateNotYetValidPair, or with any validity
+// window by GeneratePairValidity, so they don't go stale as committed
+// certificates would.
+package certmantest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// DefaultValidity is how long pairs generated by GeneratePair are
+// valid for, starting from the time they are generated.
+const DefaultValidity = 24 * time.Hour
+
+// GeneratePair writes a freshly generated self-signed certificate and
+// key for hosts to a temporary directory removed when the test ends
+// and returns the paths of the files. Hosts may be DNS names or IP
+// addresses. The certificate is valid for DefaultValidity.
+func GeneratePair(t testing.TB, hosts ...string) (certFile, keyFile string) {
+	t.Helper()
+
+	now := time.Now()
+
+	return GeneratePairValidity(t, now, now.Add(DefaultValidity), hosts...)
+}
+
+// GenerateExpiredPair is like GeneratePair but the certificate expired
+// DefaultValidity ago, having been valid for DefaultValidity before
+// that, for exercising the handling of expired certificates.
+func GenerateExpiredPair(t testing.TB, hosts ...string) (certFile, keyFile string) {
+	t.Helper()
+
+	now := time.Now()
+
+	return GeneratePairValidity(t, now.Add(-2*DefaultValidity), now.Add(-DefaultValidity), hosts...)
+}
+
+// GenerateNotYetValidPair is like GeneratePair but the certificate only
+// becomes valid DefaultValidity from now, for exercising the handling
+// of certificates deployed ahead of time.
+func GenerateNotYetValidPair(t testing.TB, hosts ...string) (certFile, keyFile string) {
+	t.Helper()
+
+	now := time.Now()
+
+	return GeneratePairValidity(t, now.Add(DefaultValidity), now.Add(2*DefaultValidity), hosts...)
+}
+
+// GeneratePairValidity is like GeneratePair but the certificate is
+// valid from notBefore until notAfter. Either may be in the past or
+// the future to generate expired or not yet valid certificates.
+func GeneratePairValidity(t testing.TB, notBefore, notAfter time.Time, hosts ...string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("certmantest: can't generate key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatalf("certmantest: can't generate serial number: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"certmantest"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("certmantest: can't create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("certmantest: can't marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+
+	return certFile, keyFile
+}
+
+func writePEM(t testing.TB, file, blockType string, der []byte) {
+	t.Helper()
+
+	b := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		t.Fatalf("certmantest: can't write %s: %v", file, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certmantest_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestGeneratePair(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com", "127.0.0.1")
+
+	leaf := loadLeaf(t, certFile, keyFile)
+
+	if !reflect.DeepEqual(leaf.DNSNames, []string{"example.com"}) {
+		t.Fatalf("unexpected DNS names: %v", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) {
+		t.Fatalf("unexpected IP addresses: %v", leaf.IPAddresses)
+	}
+	if now := time.Now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		t.Fatalf("certificate not currently valid: %v to %v", leaf.NotBefore, leaf.NotAfter)
+	}
+}
+
+func TestGeneratePairValidity(t *testing.T) {
+	notBefore := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	notAfter := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+
+	certFile, keyFile := certmantest.GeneratePairValidity(t, notBefore, notAfter)
+	leaf := loadLeaf(t, certFile, keyFile)
+
+	if !leaf.NotBefore.Equal(notBefore) || !leaf.NotAfter.Equal(notAfter) {
+		t.Fatalf("unexpected validity: %v to %v", leaf.NotBefore, leaf.NotAfter)
+	}
+}
+
+func TestGenerateExpiredPair(t *testing.T) {
+	certFile, keyFile := certmantest.GenerateExpiredPair(t, "example.com")
+	leaf := loadLeaf(t, certFile, keyFile)
+
+	if !leaf.NotAfter.Before(time.Now()) {
+		t.Fatalf("certificate not expired: %v to %v", leaf.NotBefore, leaf.NotAfter)
+	}
+}
+
+func TestGenerateNotYetValidPair(t *testing.T) {
+	certFile, keyFile := certmantest.GenerateNotYetValidPair(t, "example.com")
+	leaf := loadLeaf(t, certFile, keyFile)
+
+	if !leaf.NotBefore.After(time.Now()) {
+		t.Fatalf("certificate already valid: %v to %v", leaf.NotBefore, leaf.NotAfter)
+	}
+}
+
+func loadLeaf(t *testing.T, certFile, keyFile string) *x509.Certificate {
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not load generated pair: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse generated certificate: %v", err)
+	}
+
+	return leaf
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetChainReordering sets whether certificate files with their chain
+// out of order, such as with the leaf last, are reordered on load so
+// the leaf comes first followed by each certificate's issuer in turn,
+// as some clients require. The leaf is the certificate matching the
+// key, or with a KeySource the only one that hasn't signed another. A
+// reordered chain must form a complete path of signatures from the
+// leaf or it fails to load. Chains already in order are loaded as they
+// are. The default is false.
+func (cm *CertMan) SetChainReordering(reorder bool) {
+	cm.mu.Lock()
+	cm.reorder = reorder
+	cm.mu.Unlock()
+}
+
+// orderChain returns certPEM with its certificates reordered as
+// described for SetChainReordering, if enabled and they are out of
+// order. leaf returns the index of the leaf among the certificates, or
+// -1 if it can't be found.
+func (cm *CertMan) orderChain(certFile string, certPEM []byte, leaf func([]*x509.Certificate) int) ([]byte, error) {
+	cm.mu.RLock()
+	reorder := cm.reorder
+	cm.mu.RUnlock()
+
+	if !reorder {
+		return certPEM, nil
+	}
+
+	var certs []*x509.Certificate
+	var others []*pem.Block
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			others = append(others, block)
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+
+	if len(certs) < 2 {
+		return certPEM, nil
+	}
+
+	first := leaf(certs)
+	if first < 0 {
+		return certPEM, nil
+	}
+
+	order := []int{first}
+	used := map[int]bool{first: true}
+	for len(order) < len(certs) {
+		next := -1
+		for i, c := range certs {
+			if !used[i] && certs[order[len(order)-1]].CheckSignatureFrom(c) == nil {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		order = append(order, next)
+		used[next] = true
+	}
+
+	inOrder := true
+	for i, n := range order {
+		inOrder = inOrder && i == n
+	}
+	if inOrder {
+		return certPEM, nil
+	}
+
+	if len(order) < len(certs) {
+		return nil, errors.Errorf("can't reorder chain: %d of %d certificates don't form a path from the leaf", len(certs)-len(order), len(certs))
+	}
+
+	var b bytes.Buffer
+	for _, i := range order {
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: certs[i].Raw})
+	}
+	for _, block := range others {
+		pem.Encode(&b, block)
+	}
+
+	cm.logger().Infof("reordered certificate chain in %s", certFile)
+
+	return b.Bytes(), nil
+}
+
+// keyCertificate returns the index of the certificate in certs for a
+// private key in keyPEM, or -1 if there isn't one.
+func keyCertificate(certs []*x509.Certificate, keyPEM []byte) int {
+	for block, rest := pem.Decode(keyPEM); block != nil; block, rest = pem.Decode(rest) {
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		for i, c := range certs {
+			if publicKeyMatches(c.PublicKey, key) {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// endEntity returns the index of the only certificate in certs that
+// hasn't signed another of them, which is the leaf of a chain whose key
+// isn't at hand, or -1 if there isn't exactly one.
+func endEntity(certs []*x509.Certificate) int {
+	leaf := -1
+	for i, issuer := range certs {
+		signed := false
+		for j, c := range certs {
+			if i != j && c.CheckSignatureFrom(issuer) == nil {
+				signed = true
+				break
+			}
+		}
+		if signed {
+			continue
+		}
+		if leaf >= 0 {
+			return -1
+		}
+		leaf = i
+	}
+
+	return leaf
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dyson/certman"
+)
+
+// writeChain writes certs to file in the order given.
+func writeChain(t *testing.T, file string, certs ...*x509.Certificate) {
+	var b bytes.Buffer
+	for _, c := range certs {
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	if err := os.WriteFile(file, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChainReordering(t *testing.T) {
+	root, rootKey := issue(t, "root", true, nil, nil)
+	inter, interKey := issue(t, "intermediate", true, root, rootKey)
+	leafCert, leafKey := issue(t, "example.com", false, inter, interKey)
+	other, _ := issue(t, "other root", true, nil, nil)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "tls.key")
+	writeKey(t, keyFile, leafKey)
+
+	tests := []struct {
+		name   string
+		chain  []*x509.Certificate
+		want   []*x509.Certificate
+		log    string
+		loaded bool
+	}{
+		{"in order", []*x509.Certificate{leafCert, inter, root}, []*x509.Certificate{leafCert, inter, root}, "", true},
+		{"leaf last", []*x509.Certificate{root, inter, leafCert}, []*x509.Certificate{leafCert, inter, root}, "INFO reordered certificate chain", true},
+		{"scrambled", []*x509.Certificate{inter, leafCert, root}, []*x509.Certificate{leafCert, inter, root}, "INFO reordered certificate chain", true},
+		{"broken path", []*x509.Certificate{other, leafCert, inter}, nil, "don't form a path", false},
+	}
+
+	for _, tt := range tests {
+		buf := new(syncBuffer)
+
+		certFile := filepath.Join(dir, "tls.crt")
+		writeChain(t, certFile, tt.chain...)
+
+		cm, err := certman.New(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{buf})
+		cm.SetChainReordering(true)
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		cm.Stop()
+
+		if loaded := cm.Status().Loaded; loaded != tt.loaded {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("%s: loaded %v, want %v", tt.name, loaded, tt.loaded)
+		}
+		if tt.log == "" && strings.Contains(buf.String(), "reordered") ||
+			tt.log != "" && !strings.Contains(buf.String(), tt.log) {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("%s: log from certman not as expected", tt.name)
+		}
+		if !tt.loaded {
+			continue
+		}
+
+		cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("%s: could not get certificate: %v", tt.name, err)
+		}
+		if len(cert.Certificate) != len(tt.want) {
+			t.Fatalf("%s: chain of %d certificates, want %d", tt.name, len(cert.Certificate), len(tt.want))
+		}
+		for i, c := range tt.want {
+			if !bytes.Equal(cert.Certificate[i], c.Raw) {
+				t.Fatalf("%s: certificate %d of chain is out of order", tt.name, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// A cidrRoute serves the certificate of pair, nil being the pair passed
+// to New, to clients connecting from network.
+type cidrRoute struct {
+	network *net.IPNet
+	pair    *pair
+}
+
+// A servedRoute is a cidrRoute resolved to the certificate it serves,
+// nil if its pair isn't loaded.
+type servedRoute struct {
+	network *net.IPNet
+	keyPair *tls.Certificate
+}
+
+// MapCIDR serves the certificate at certIndex to clients connecting
+// from an address within cidr, regardless of the server name they
+// request. Index 0 is the pair passed to New and the pairs added with
+// AddPair follow in the order they were added. The mapping follows the
+// pair at certIndex when it is made, so pairs being renumbered by a
+// manifest reload doesn't change it, and a pair removed by one is no
+// longer served. When a client's address is within several mapped
+// ranges the most specific is used. Clients outside every mapped
+// range, or mapped to a pair that isn't loaded, are served by server
+// name as usual.
+func (cm *CertMan) MapCIDR(cidr string, certIndex int) error {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return errors.Wrap(err, "can't map cidr")
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if certIndex < 0 || certIndex > len(cm.pairs) {
+		return errors.Errorf("can't map cidr: no certificate at index %d", certIndex)
+	}
+
+	cm.routes = append(cm.routes, cidrRoute{network: network, pair: cm.pairAt(certIndex)})
+	cm.storeSnapshot()
+
+	return nil
+}
+
+// selectByAddr returns the loaded certificate mapped to the address of
+// the client sending hello, or nil if there isn't one.
+func (s *serveState) selectByAddr(hello *tls.ClientHelloInfo) *tls.Certificate {
+	if len(s.routes) == 0 || hello.Conn == nil {
+		return nil
+	}
+
+	ip := remoteIP(hello.Conn.RemoteAddr())
+	if ip == nil {
+		return nil
+	}
+
+	var selected *tls.Certificate
+	longest := -1
+	for _, r := range s.routes {
+		ones, _ := r.network.Mask.Size()
+		if ones <= longest || r.keyPair == nil || !r.network.Contains(ip) {
+			continue
+		}
+
+		selected, longest = r.keyPair, ones
+	}
+
+	return selected
+}
+
+// remoteIP returns the IP address of addr, or nil if it doesn't have
+// one.
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case nil:
+		return nil
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	return net.ParseIP(host)
+}
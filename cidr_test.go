@@ -0,0 +1,92 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestMapCIDR(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "example.com")
+	internalCert, internalKey := certmantest.GeneratePair(t, "internal.test")
+	lanCert, lanKey := certmantest.GeneratePair(t, "lan.internal.test")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	for _, p := range [][2]string{{internalCert, internalKey}, {lanCert, lanKey}} {
+		if err := cm.AddPair(p[0], p[1]); err != nil {
+			t.Fatalf("could not add pair: %v", err)
+		}
+	}
+	if err := cm.MapCIDR("10.0.0.0/8", 1); err != nil {
+		t.Fatalf("could not map cidr: %v", err)
+	}
+	if err := cm.MapCIDR("10.1.0.0/16", 2); err != nil {
+		t.Fatalf("could not map cidr: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	tests := []struct {
+		addr       string
+		serverName string
+		want       string
+	}{
+		{"10.2.3.4:443", "example.com", "internal.test"},
+		{"10.1.3.4:443", "example.com", "lan.internal.test"},
+		{"192.0.2.1:443", "example.com", "example.com"},
+		{"192.0.2.1:443", "internal.test", "internal.test"},
+	}
+
+	for _, tt := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert, err := cm.GetCertificate(&tls.ClientHelloInfo{
+			ServerName: tt.serverName,
+			Conn:       addrConn{addr: addr},
+		})
+		if err != nil {
+			t.Fatalf("could not get certman certificate: %v", err)
+		}
+		if got := cert.Leaf.DNSNames[0]; got != tt.want {
+			t.Errorf("client %s served %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestMapCIDRInvalid(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.MapCIDR("10.0.0.0", 0); err == nil {
+		t.Fatalf("invalid cidr mapped")
+	}
+	if err := cm.MapCIDR("10.0.0.0/8", 1); err == nil {
+		t.Fatalf("cidr mapped to missing pair")
+	}
+}
+
+// addrConn is a net.Conn with only a remote address.
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.addr }
@@ -0,0 +1,52 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "path/filepath"
+
+// SetReloadOnCloseWrite sets whether the certificate and key files,
+// when written in place, are loaded only once the writer closes them,
+// rather than once writes have paused for the coalesce window, so a
+// writer keeping a file open while writing it incrementally isn't read
+// part way through. Files replaced by a rename are loaded as usual.
+// Closes are only seen on Linux, using inotify's IN_CLOSE_WRITE which
+// fsnotify doesn't report; on other platforms, or if the close watch
+// can't be set up or stops, writes are loaded after the coalesce
+// window as before and a warning is logged. The close watch is set up
+// again whenever the watch is re-established or restarted. It must be
+// called before Watch.
+func (cm *CertMan) SetReloadOnCloseWrite(closeWrite bool) {
+	cm.mu.Lock()
+	cm.closeWrite = closeWrite
+	cm.mu.Unlock()
+}
+
+// closeWrites returns a channel receiving the names of files closed
+// after writing in the directories of the certificate and key files,
+// and a function stopping it, or a nil channel if reloading on close
+// isn't set or supported.
+func (cm *CertMan) closeWrites() (<-chan string, func()) {
+	cm.mu.RLock()
+	closeWrite := cm.closeWrite
+	cm.mu.RUnlock()
+
+	if !closeWrite {
+		return nil, func() {}
+	}
+
+	certFile, keyFile := cm.files()
+	dirs := []string{filepath.Dir(certFile)}
+	if keyDir := filepath.Dir(keyFile); keyDir != dirs[0] {
+		dirs = append(dirs, keyDir)
+	}
+
+	closed, stop, err := watchCloseWrites(dirs)
+	if err != nil {
+		cm.logger().Warnf("can't watch for files closed after writing, reloading once writes pause: %v", err)
+		return nil, func() {}
+	}
+
+	return closed, stop
+}
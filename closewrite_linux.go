@@ -0,0 +1,83 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// watchCloseWrites returns a channel receiving the names of files
+// closed after writing in dirs, and a function stopping it. The
+// channel is closed once stopped or if reading inotify fails.
+func watchCloseWrites(dirs []string) (<-chan string, func(), error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't create inotify instance")
+	}
+
+	// A non-blocking file uses the runtime poller, so Close interrupts
+	// a pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	wds := map[int32]string{}
+	for _, dir := range dirs {
+		wd, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE)
+		if err != nil {
+			f.Close()
+			return nil, nil, errors.Wrapf(err, "can't watch %s", dir)
+		}
+		wds[int32(wd)] = dir
+	}
+
+	closed := make(chan string)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+
+		var buf [(unix.SizeofInotifyEvent + unix.NAME_MAX + 1) * 16]byte
+		for {
+			n, err := f.Read(buf[:])
+			if err != nil {
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + unix.SizeofInotifyEvent
+				offset = start + int(event.Len)
+
+				dir, ok := wds[event.Wd]
+				if !ok || event.Len == 0 {
+					continue
+				}
+				name := strings.TrimRight(string(buf[start:offset]), "\x00")
+
+				select {
+				case closed <- filepath.Join(dir, name):
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			f.Close()
+		})
+	}
+
+	return closed, stop, nil
+}
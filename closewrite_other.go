@@ -0,0 +1,15 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package certman
+
+import "github.com/pkg/errors"
+
+// watchCloseWrites reports that closes after writing aren't seen on
+// this platform.
+func watchCloseWrites(dirs []string) (<-chan string, func(), error) {
+	return nil, nil, errors.New("close events not supported on this platform")
+}
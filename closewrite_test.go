@@ -0,0 +1,129 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+)
+
+func TestReloadOnCloseWrite(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("close events are only seen on linux")
+	}
+
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetSettleDelay(150 * time.Millisecond)
+	cm.SetReloadOnCloseWrite(true)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	der := renew(t, "./testdata/server1.crt", "./testdata/server1.key")
+	renewed := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	// Write half the certificate in place and pause for longer than
+	// the coalesce window and settle delay before writing the rest.
+	f, err := os.OpenFile(crt, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(renewed[:len(renewed)/2]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if err := cm.LastError(); err != nil {
+		f.Close()
+		t.Fatalf("part written certificate loaded: %v", err)
+	}
+
+	if _, err := f.Write(renewed[len(renewed)/2:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, cm)
+
+	if served := cm.Snapshot(); string(served.Certificate[0]) != string(der) {
+		t.Fatalf("renewed certificate not loaded")
+	}
+}
+
+func TestReloadOnCloseWriteAfterRecovery(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("close events are only seen on linux")
+	}
+
+	dir := filepath.Join(t.TempDir(), "certs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	recovered := make(chan struct{}, 1)
+	cm.SetRewatchDelay(50 * time.Millisecond)
+	cm.SetSettleDelay(150 * time.Millisecond)
+	cm.SetReloadOnCloseWrite(true)
+	cm.OnWatchRecovered(func() { recovered <- struct{}{} })
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	// The directory's close watch goes with it, so it must be set up
+	// again along with the watcher.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	select {
+	case <-recovered:
+	case <-time.After(time.Second):
+		t.Fatalf("watch not recovered")
+	}
+
+	der := renew(t, "./testdata/server1.crt", "./testdata/server1.key")
+	if err := os.WriteFile(crt, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, cm)
+
+	if served := cm.Snapshot(); string(served.Certificate[0]) != string(der) {
+		t.Fatalf("renewed certificate not loaded")
+	}
+}
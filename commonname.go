@@ -0,0 +1,51 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// SetCommonNameFallback sets whether certificates without any DNS
+// names, such as legacy certificates from an old PKI, are selected by
+// server name using their subject common name, for use while migrating
+// from them. By default, as crypto/x509 does, the common name is
+// ignored so such certificates are only served as the default. Loading
+// a certificate selected by its common name is logged as a warning. It
+// applies from the next load.
+func (cm *CertMan) SetCommonNameFallback(fallback bool) {
+	cm.mu.Lock()
+	cm.cnFallback = fallback
+	cm.mu.Unlock()
+}
+
+// leafNames returns the names leaf is selected by. cm.mu must be held
+// for reading.
+func (cm *CertMan) leafNames(leaf *x509.Certificate) []string {
+	if cm.commonNameOnly(leaf) {
+		return []string{leaf.Subject.CommonName}
+	}
+
+	return leaf.DNSNames
+}
+
+// commonNameOnly reports whether leaf is selected by its common name
+// for want of DNS names. cm.mu must be held for reading.
+func (cm *CertMan) commonNameOnly(leaf *x509.Certificate) bool {
+	return cm.cnFallback && len(leaf.DNSNames) == 0 && leaf.Subject.CommonName != ""
+}
+
+// warnCommonName logs a warning if the certificate loaded from
+// certFile is selected by its common name.
+func (cm *CertMan) warnCommonName(certFile string, keyPair *tls.Certificate) {
+	cm.mu.RLock()
+	cnOnly := cm.commonNameOnly(keyPair.Leaf)
+	cm.mu.RUnlock()
+
+	if cnOnly {
+		cm.logger().Warnf("certificate in %s has no DNS names, selecting it by common name %s", certFile, keyPair.Leaf.Subject.CommonName)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestCommonNameFallback(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "default.test")
+
+	dir := t.TempDir()
+	legacyCert, legacyKey := filepath.Join(dir, "legacy.crt"), filepath.Join(dir, "legacy.key")
+	cert, key := issue(t, "legacy.test", true, nil, nil)
+	writeCert(t, legacyCert, cert)
+	writeKey(t, legacyKey, key)
+
+	for _, fallback := range []bool{false, true} {
+		buf := new(syncBuffer)
+
+		cm, err := certman.New(defaultCert, defaultKey)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{buf})
+		cm.SetCommonNameFallback(fallback)
+		if err := cm.AddPair(legacyCert, legacyKey); err != nil {
+			t.Fatalf("could not add pair: %v", err)
+		}
+		if _, err := cm.Reload(); err != nil {
+			t.Fatalf("could not load pairs: %v", err)
+		}
+
+		served, err := cm.GetCertificate(&tls.ClientHelloInfo{ServerName: "legacy.test"})
+		if err != nil {
+			t.Fatalf("could not get certman certificate: %v", err)
+		}
+
+		want := "default.test"
+		if fallback {
+			want = "legacy.test"
+		}
+		got := served.Leaf.Subject.CommonName
+		if len(served.Leaf.DNSNames) > 0 {
+			got = served.Leaf.DNSNames[0]
+		}
+		if got != want {
+			t.Fatalf("fallback %v: served %s, want %s", fallback, got, want)
+		}
+
+		warned := strings.Contains(buf.String(), "WARN certificate in "+legacyCert+" has no DNS names")
+		if warned != fallback {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("fallback %v: common name selection warned %v", fallback, warned)
+		}
+	}
+}
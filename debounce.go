@@ -0,0 +1,197 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// defaultCoalesceWindow is long enough to merge the events of a
+	// single write or rename while keeping reloads prompt.
+	defaultCoalesceWindow = 100 * time.Millisecond
+
+	// defaultSettleDelay is long enough for tools writing the
+	// certificate and key files one after the other to finish.
+	defaultSettleDelay = time.Second
+)
+
+// SetCoalesceWindow sets how long certMan waits after an event for
+// further events before reloading, so a burst of events causes a
+// single reload. The default is 100ms.
+func (cm *CertMan) SetCoalesceWindow(d time.Duration) {
+	cm.mu.Lock()
+	cm.coalesce = d
+	cm.mu.Unlock()
+}
+
+// SetSettleDelay sets how long certMan waits, from the first event,
+// for the other file of a pair when only one of its certificate and
+// key files has changed and the files don't hold a matching pair.
+// This avoids loading a new certificate with an old key when the files
+// aren't written atomically, while a certificate renewed with the same
+// key is reloaded without waiting. If the other file doesn't change
+// within the delay the pair is reloaded anyway. The default is 1s.
+func (cm *CertMan) SetSettleDelay(d time.Duration) {
+	cm.mu.Lock()
+	cm.settle = d
+	cm.mu.Unlock()
+}
+
+// SetSplitPairWait sets whether, when the certificate and key files are
+// in different directories, a change to either waits for both to have
+// been modified since they were last loaded before reloading, up to
+// the settle delay from the first event. Their changes are seen by
+// separate watches so may arrive apart, and this avoids reloading
+// between a tool writing one and the other even when the files in
+// between hold a matching pair. The default is false.
+func (cm *CertMan) SetSplitPairWait(wait bool) {
+	cm.mu.Lock()
+	cm.splitWait = wait
+	cm.mu.Unlock()
+}
+
+// NextReloadAt returns when the reload waiting for the coalesce window
+// or settle delay to pass is scheduled, and whether one is, for
+// diagnosing why a change hasn't been loaded yet.
+func (cm *CertMan) NextReloadAt() (time.Time, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.reloadAt, !cm.reloadAt.IsZero()
+}
+
+// setReloadAt records when the next reload is scheduled, or the zero
+// time if none is.
+func (cm *CertMan) setReloadAt(t time.Time) {
+	cm.mu.Lock()
+	cm.reloadAt = t
+	cm.mu.Unlock()
+}
+
+// A batch collects the events seen while waiting to reload.
+type batch struct {
+	first time.Time
+	names []string
+
+	// all is set when a projection marker or a file in a recursively
+	// watched tree changed, meaning every file in the directory may
+	// have changed at once.
+	all bool
+
+	// last is the most recent event added.
+	last fsnotify.Event
+}
+
+// add adds event to the batch.
+func (b *batch) add(event fsnotify.Event, marker bool) {
+	if b.first.IsZero() {
+		b.first = time.Now()
+	}
+
+	b.names = append(b.names, event.Name)
+	b.all = b.all || marker
+	b.last = event
+}
+
+// has reports whether the batch includes an event for file.
+func (b *batch) has(file string) bool {
+	for _, name := range b.names {
+		if sameFile(name, file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wait returns how much longer to wait before reloading the batch, or
+// zero to reload now. After the coalesce window the batch is reloaded
+// unless a pair has had only one of its files change and the files
+// don't yet hold a matching certificate and key, in which case the
+// wait extends until the other file changes or the settle delay has
+// passed since the first event of the batch.
+func (cm *CertMan) wait(b *batch) time.Duration {
+	if b.all {
+		return 0
+	}
+
+	certFile, keyFile := cm.files()
+	files := [][2]string{{certFile, keyFile}}
+
+	cm.mu.RLock()
+	for _, p := range cm.pairs {
+		files = append(files, [2]string{p.certFile, p.keyFile})
+	}
+	settle := cm.settle
+	splitWait, loadedAt := cm.splitWait, cm.loadedAt
+	cm.mu.RUnlock()
+
+	if splitWait && filepath.Dir(certFile) != filepath.Dir(keyFile) &&
+		(b.has(certFile) || b.has(keyFile)) &&
+		!(modifiedSince(certFile, loadedAt) && modifiedSince(keyFile, loadedAt)) {
+		if d := time.Until(b.first.Add(settle)); d > 0 {
+			return d
+		}
+	}
+
+	for _, f := range files {
+		if b.has(f[0]) != b.has(f[1]) && !cm.consistent(f[0], f[1]) {
+			if d := time.Until(b.first.Add(settle)); d > 0 {
+				return d
+			}
+		}
+	}
+
+	return 0
+}
+
+// modifiedSince reports whether file was modified after t.
+func modifiedSince(file string, t time.Time) bool {
+	fi, err := os.Stat(file)
+
+	return err == nil && fi.ModTime().After(t)
+}
+
+// consistent reports whether certFile and keyFile currently hold a
+// certificate and a key matching it, decoded as they are for loading.
+// The pair passed to New is always consistent when its key comes from
+// a key source, as there is no key file to wait for.
+func (cm *CertMan) consistent(certFile, keyFile string) bool {
+	cm.mu.RLock()
+	keySource := cm.keySource
+	cm.mu.RUnlock()
+
+	if primary, _ := cm.files(); keySource != nil && certFile == primary {
+		return true
+	}
+
+	certPEM, err := readPEM(nil, certFile)
+	if err != nil {
+		return false
+	}
+
+	keyPEM, err := readPEM(nil, keyFile)
+	if err != nil {
+		return false
+	}
+
+	if certPEM, keyPEM, err = cm.decodeKeyPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+		return false
+	}
+
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err == nil {
+		return true
+	}
+
+	_, _, err = matchKey(certPEM, keyPEM)
+
+	return err == nil
+}
@@ -0,0 +1,298 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"encoding/pem"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestCoalesceWindow(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	cm.SetCoalesceWindow(150 * time.Millisecond)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	buf.Reset()
+	for i := 0; i < 5; i++ {
+		newCert, newKey := certmantest.GeneratePair(t, "example.com")
+		copyFile(newCert, certFile)
+		copyFile(newKey, keyFile)
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	logGot := buf.String()
+	if n := strings.Count(logGot, "certificate and key loaded"); n != 1 {
+		t.Log("log output received:", logGot)
+		t.Fatalf("expected 1 load, got %d", n)
+	}
+	if strings.Contains(logGot, "can't load") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("burst caused a failed load")
+	}
+}
+
+func TestSettleDelay(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	cm.SetCoalesceWindow(50 * time.Millisecond)
+	cm.SetSettleDelay(500 * time.Millisecond)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// The key lands well after the certificate but within the settle
+	// delay so the pair loads once without a mismatch.
+	buf.Reset()
+	newCert, newKey := certmantest.GeneratePair(t, "example.com")
+	copyFile(newCert, certFile)
+	time.Sleep(250 * time.Millisecond)
+	copyFile(newKey, keyFile)
+	time.Sleep(200 * time.Millisecond)
+
+	logGot := buf.String()
+	if strings.Count(logGot, "certificate and key loaded") != 1 || strings.Contains(logGot, "can't load") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("staggered pair not loaded once")
+	}
+
+	// A certificate changing alone to one not matching the key waits
+	// for the delay to pass.
+	buf.Reset()
+	otherCert, _ := certmantest.GeneratePair(t, "example.com")
+	copyFile(otherCert, certFile)
+	time.Sleep(250 * time.Millisecond)
+
+	if logGot := buf.String(); strings.Contains(logGot, "can't load") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("mismatched certificate loaded before settle delay")
+	}
+
+	time.Sleep(400 * time.Millisecond)
+
+	if logGot := buf.String(); !strings.Contains(logGot, "can't load") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("mismatched certificate not loaded after settle delay")
+	}
+}
+
+func TestSettleDelayConsistentPair(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	cm.SetCoalesceWindow(50 * time.Millisecond)
+	cm.SetSettleDelay(time.Second)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// A certificate renewed with the same key already matches it so
+	// is loaded without waiting for the delay.
+	buf.Reset()
+	copyFile(certFile, certFile+".copy")
+	copyFile(certFile+".copy", certFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if logGot := buf.String(); !strings.Contains(logGot, "certificate and key loaded") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("matching certificate not loaded before settle delay")
+	}
+
+	// Staggered writes of a new pair hold the reload until the key
+	// arrives, then load promptly.
+	buf.Reset()
+	newCert, newKey := certmantest.GeneratePair(t, "example.com")
+	copyFile(newCert, certFile)
+	time.Sleep(300 * time.Millisecond)
+
+	if logGot := buf.String(); strings.Contains(logGot, "loaded") || strings.Contains(logGot, "can't load") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("pair reloaded before the key arrived")
+	}
+
+	copyFile(newKey, keyFile)
+	time.Sleep(200 * time.Millisecond)
+
+	logGot := buf.String()
+	if strings.Count(logGot, "certificate and key loaded") != 1 || strings.Contains(logGot, "can't load") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("staggered pair not loaded once")
+	}
+	if !servedCert(t, cm, newCert, newKey) {
+		t.Fatalf("staggered pair not served")
+	}
+}
+
+func TestNextReloadAt(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetCoalesceWindow(300 * time.Millisecond)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if _, pending := cm.NextReloadAt(); pending {
+		t.Fatalf("reload pending before any change")
+	}
+
+	start := time.Now()
+	newCert, newKey := certmantest.GeneratePair(t, "example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+	time.Sleep(100 * time.Millisecond)
+
+	at, pending := cm.NextReloadAt()
+	if !pending {
+		t.Fatalf("no reload pending after change")
+	}
+	if at.Before(start) || at.After(time.Now().Add(300*time.Millisecond)) {
+		t.Fatalf("reload scheduled at %v, outside the coalesce window", at)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+
+	if _, pending := cm.NextReloadAt(); pending {
+		t.Fatalf("reload still pending after the coalesce window")
+	}
+}
+
+func TestSplitPairWait(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	genCert, genKey := certmantest.GeneratePair(t, "example.com")
+	certFile := filepath.Join(t.TempDir(), "tls.crt")
+	keyFile := filepath.Join(t.TempDir(), "tls.key")
+	copyFile(genCert, certFile)
+	copyFile(genKey, keyFile)
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	cm.SetCoalesceWindow(50 * time.Millisecond)
+	cm.SetSettleDelay(2 * time.Second)
+	cm.SetSplitPairWait(true)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// File timestamps come from a coarser clock than the load time,
+	// so changes made immediately after the load can look older.
+	time.Sleep(50 * time.Millisecond)
+
+	// A renewed certificate matches the old key, but the key is
+	// rewritten too, in the other directory, so the reload waits.
+	buf.Reset()
+	writePEMFile(t, certFile, &pem.Block{Type: "CERTIFICATE", Bytes: renew(t, certFile, keyFile)})
+	time.Sleep(300 * time.Millisecond)
+
+	if logGot := buf.String(); strings.Contains(logGot, "loaded") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("pair reloaded before the key was rewritten")
+	}
+
+	copyFile(keyFile, keyFile+".copy")
+	copyFile(keyFile+".copy", keyFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if logGot := buf.String(); strings.Count(logGot, "certificate and key loaded") != 1 {
+		t.Log("log output received:", logGot)
+		t.Fatalf("split pair not loaded once")
+	}
+}
+
+func TestSettleDelayConsistentDERPair(t *testing.T) {
+	buf := new(syncBuffer)
+
+	pemCert, pemKey := certmantest.GeneratePair(t, "example.com")
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.der"), filepath.Join(dir, "tls.key.der")
+	for _, f := range [][2]string{{pemCert, certFile}, {pemKey, keyFile}} {
+		b, err := os.ReadFile(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(b)
+		if err := os.WriteFile(f[1], block.Bytes, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	cm.SetCoalesceWindow(50 * time.Millisecond)
+	cm.SetSettleDelay(time.Second)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// The certificate is rewritten alone, still matching the DER key,
+	// so is loaded without waiting for the delay.
+	buf.Reset()
+	copyFile(certFile, certFile+".copy")
+	copyFile(certFile+".copy", certFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if logGot := buf.String(); !strings.Contains(logGot, "certificate and key loaded") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("matching DER certificate not loaded before settle delay")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// pemBegin starts a PEM block.
+var pemBegin = []byte("-----BEGIN")
+
+// SetStrictPEM sets whether certificate files must hold only PEM
+// blocks. By default DER encoded certificates found between or instead
+// of the PEM blocks, as some tools concatenate, are loaded into the
+// chain in the order they appear. In strict mode a certificate file
+// holding anything but PEM blocks and whitespace fails to load.
+func (cm *CertMan) SetStrictPEM(strict bool) {
+	cm.mu.Lock()
+	cm.strictPEM = strict
+	cm.mu.Unlock()
+}
+
+// normalizeCerts returns certPEM with the DER encoded certificates
+// outside its PEM blocks converted to PEM, or an error if there are any
+// in strict mode.
+func (cm *CertMan) normalizeCerts(certPEM []byte) ([]byte, error) {
+	out, mixed := mixedToPEM(certPEM)
+	if !mixed {
+		return certPEM, nil
+	}
+
+	cm.mu.RLock()
+	strict := cm.strictPEM
+	cm.mu.RUnlock()
+
+	if strict {
+		return nil, errors.New("cert file contains data that isn't PEM")
+	}
+
+	return out, nil
+}
+
+// mixedToPEM converts the DER encoded certificates in b outside its
+// PEM blocks to PEM blocks, keeping their order, and reports whether b
+// held anything other than PEM blocks and whitespace. Data that isn't
+// a certificate is dropped, as pem.Decode skips it.
+func mixedToPEM(b []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	mixed := false
+
+	for len(b) > 0 {
+		seg := b
+		i := bytes.Index(b, pemBegin)
+		if i >= 0 {
+			seg = b[:i]
+		}
+
+		if len(bytes.TrimSpace(seg)) > 0 {
+			mixed = true
+			for der := bytes.TrimLeft(seg, " \t\r\n"); len(der) > 0; {
+				var raw asn1.RawValue
+				rest, err := asn1.Unmarshal(der, &raw)
+				if err != nil {
+					break
+				}
+				if _, err := x509.ParseCertificate(raw.FullBytes); err == nil {
+					pem.Encode(&out, &pem.Block{Type: "CERTIFICATE", Bytes: raw.FullBytes})
+				}
+				der = bytes.TrimLeft(rest, " \t\r\n")
+			}
+		}
+
+		if i < 0 {
+			break
+		}
+
+		block, rest := pem.Decode(b[i:])
+		if block == nil {
+			out.Write(b[i:])
+			break
+		}
+		pem.Encode(&out, block)
+		b = rest
+	}
+
+	return out.Bytes(), mixed
+}
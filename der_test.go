@@ -0,0 +1,78 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestMixedDER(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	otherCertFile, _ := certmantest.GeneratePair(t, "other.example.com")
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatalf("could not read cert file: %v", err)
+	}
+	leaf, _ := pem.Decode(certPEM)
+
+	otherPEM, err := os.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatalf("could not read cert file: %v", err)
+	}
+
+	mixedFile := filepath.Join(t.TempDir(), "mixed.crt")
+	mixed := append(append([]byte{}, leaf.Bytes...), otherPEM...)
+	if err := os.WriteFile(mixedFile, mixed, 0644); err != nil {
+		t.Fatalf("could not write mixed cert file: %v", err)
+	}
+
+	cm, err := certman.New(mixedFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+	cm.Logger(log.New(new(syncBuffer), "", 0))
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("could not get certificate: %v", err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Fatalf("got a chain of %d certificates, want 2", len(cert.Certificate))
+	}
+	if !bytes.Equal(cert.Certificate[0], leaf.Bytes) {
+		t.Fatalf("DER leaf not served first")
+	}
+	cm.Stop()
+
+	strict, err := certman.New(mixedFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+	strict.Logger(log.New(new(syncBuffer), "", 0))
+	strict.SetStrictPEM(true)
+
+	if err := strict.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer strict.Stop()
+
+	if strict.Status().Loaded {
+		t.Fatalf("mixed cert file loaded in strict mode")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// SetWatchFiles sets whether the certificate and key files are watched
+// themselves rather than the directories holding them. Watching the
+// directories, the default, sees the files replaced by a rename, by a
+// hardlink or by Kubernetes swapping the symlinked directory of a
+// projected secret, so suits Kubernetes. Watching the files avoids
+// events for other files in busy directories and can be more reliable
+// on some local and network file systems, but the projection marker
+// isn't seen so secret store swaps may be missed. A file replaced by a
+// rename is watched again once the replacement is loaded. The other
+// watched files are unaffected. It must be called before Watch.
+func (cm *CertMan) SetWatchFiles(direct bool) {
+	cm.mu.Lock()
+	cm.direct = direct
+	cm.mu.Unlock()
+}
+
+// watchingFiles reports whether the certificate and key files are
+// watched themselves.
+func (cm *CertMan) watchingFiles() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.direct
+}
+
+// watchFiles adds the certificate and key files to watcher.
+func (cm *CertMan) watchFiles(watcher *fsnotify.Watcher) error {
+	certFile, keyFile := cm.files()
+
+	if err := addWatch(watcher, certFile); err != nil {
+		return errors.Wrap(err, "can't watch cert file")
+	}
+
+	if err := addWatch(watcher, keyFile); err != nil {
+		return errors.Wrap(err, "can't watch key file")
+	}
+
+	return nil
+}
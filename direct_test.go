@@ -0,0 +1,40 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestWatchFiles(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "first.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetWatchFiles(true)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// Each replacement is seen, so the replaced files are watched
+	// again after a reload.
+	for _, name := range []string{"second.example.com", "third.example.com"} {
+		newCert, newKey := certmantest.GeneratePair(t, name)
+		copyFile(newCert, certFile)
+		copyFile(newKey, keyFile)
+		waitReload(t, cm)
+
+		if got := servedName(t, cm, ""); got != name {
+			t.Fatalf("serving %q after replacing files, want %q", got, name)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "bytes"
+
+// Equal reports whether cm and other serve the same certificate chain
+// by default, comparing the DER bytes of each certificate. Private
+// keys aren't compared. Two certMans with nothing loaded are equal.
+func (cm *CertMan) Equal(other *CertMan) bool {
+	a, b := cm.chain(), other.chain()
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// chain returns the DER encoded certificate chain served by default,
+// or nil if none is loaded.
+func (cm *CertMan) chain() [][]byte {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.keyPair == nil {
+		return nil
+	}
+
+	return cm.keyPair.Certificate
+}
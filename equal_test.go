@@ -0,0 +1,44 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"testing"
+
+	"github.com/dyson/certman"
+)
+
+func TestEqual(t *testing.T) {
+	newCertMan := func(crt, key string) *certman.CertMan {
+		cm, err := certman.New(crt, key)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+		if _, err := cm.Reload(); err != nil {
+			t.Fatalf("could not load files: %v", err)
+		}
+
+		return cm
+	}
+
+	a := newCertMan("./testdata/server1.crt", "./testdata/server1.key")
+	b := newCertMan("./testdata/server1.crt", "./testdata/server1.key")
+	c := newCertMan("./testdata/server2.crt", "./testdata/server2.key")
+
+	if !a.Equal(b) || !a.Equal(a) {
+		t.Fatalf("certmans serving the same certificate not equal")
+	}
+	if a.Equal(c) {
+		t.Fatalf("certmans serving different certificates equal")
+	}
+
+	empty, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+	if a.Equal(empty) {
+		t.Fatalf("certman with nothing loaded equal to a loaded one")
+	}
+}
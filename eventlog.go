@@ -0,0 +1,33 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "github.com/fsnotify/fsnotify"
+
+// SetLoggedEventOps sets which operations a watch event must include
+// for it to be logged at debug level, for example
+// fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove to
+// drop the chmod events some file systems produce in bulk. Events are
+// acted on whether they are logged or not. By default every event is
+// logged.
+func (cm *CertMan) SetLoggedEventOps(ops fsnotify.Op) {
+	cm.mu.Lock()
+	cm.quietOps = ^ops
+	cm.mu.Unlock()
+}
+
+// logEvent logs event unless its operations are all excluded by
+// SetLoggedEventOps.
+func (cm *CertMan) logEvent(event fsnotify.Event) {
+	cm.mu.RLock()
+	quiet := cm.quietOps
+	cm.mu.RUnlock()
+
+	if quiet != 0 && event.Op&^quiet == 0 {
+		return
+	}
+
+	cm.logger().Debugf("watch event: %v", event)
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestLoggedEventOps(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		buf := new(syncBuffer)
+
+		certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+		cm, err := certman.New(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.Logger(log.New(buf, "", 0))
+		if quiet {
+			cm.SetLoggedEventOps(fsnotify.Write | fsnotify.Create | fsnotify.Rename | fsnotify.Remove)
+		}
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+
+		if err := os.Chmod(keyFile, 0400); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+
+		if logged := strings.Contains(buf.String(), "CHMOD"); logged == quiet {
+			cm.Stop()
+			t.Log("log output received:", buf.String())
+			t.Fatalf("quiet %v: chmod event logged %v", quiet, logged)
+		}
+
+		copyFile(keyFile, keyFile+".copy")
+		copyFile(keyFile+".copy", keyFile)
+		time.Sleep(200 * time.Millisecond)
+		cm.Stop()
+
+		if !strings.Contains(buf.String(), "CREATE") {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("quiet %v: create event not logged", quiet)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"sync"
+	"time"
+)
+
+// eventBuffer is the capacity of the channels returned by Events.
+const eventBuffer = 64
+
+// An EventType is the kind of an Event.
+type EventType int
+
+const (
+	// EventLoaded is sent when a certificate and key pair is loaded.
+	EventLoaded EventType = iota + 1
+
+	// EventLoadFailed is sent when a certificate and key pair fails
+	// to load.
+	EventLoadFailed
+
+	// EventWatchStarted is sent when watching starts.
+	EventWatchStarted
+
+	// EventWatchStopped is sent when watching stops.
+	EventWatchStopped
+
+	// EventRecovered is sent when a lost watch is re-established.
+	EventRecovered
+)
+
+// An Event is a change in the lifecycle of certMan.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Path is the certificate file concerned, for EventLoaded and
+	// EventLoadFailed.
+	Path string
+
+	// Fingerprint is the SHA-256 fingerprint of the loaded leaf
+	// certificate, for EventLoaded.
+	Fingerprint [32]byte
+
+	// Err is the error, for EventLoadFailed.
+	Err error
+}
+
+// Events returns a channel receiving an Event for each load, failed
+// load, start and stop of watching and recovery of a lost watch, as a
+// single stream in place of the individual callbacks, and a func that
+// stops sending to the channel and closes it. Each call returns a new
+// channel, which is sent to until the func is called, so it must be
+// called once the events are no longer wanted. Sends don't block:
+// events are dropped while the channel's buffer is full, so it should
+// be drained promptly.
+func (cm *CertMan) Events() (<-chan Event, func()) {
+	c := make(chan Event, eventBuffer)
+
+	cm.mu.Lock()
+	cm.events = append(cm.events, c)
+	cm.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			cm.mu.Lock()
+			for i, e := range cm.events {
+				if e == c {
+					cm.events = append(cm.events[:i:i], cm.events[i+1:]...)
+					break
+				}
+			}
+			cm.mu.Unlock()
+
+			close(c)
+		})
+	}
+
+	return c, cancel
+}
+
+// publish sends e, stamped with the current time, to the channels
+// returned by Events without blocking. It must not be called with
+// cm.mu held.
+func (cm *CertMan) publish(e Event) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	e.Time = cm.now()
+
+	for _, c := range cm.events {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestEvents(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetSettleDelay(0)
+	events, cancel := cm.Events()
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	e := nextEvent(t, events)
+	if e.Type != certman.EventLoaded || e.Path != certFile || e.Fingerprint != sha256.Sum256(leaf(t, certFile).Raw) {
+		t.Fatalf("unexpected first event: %+v", e)
+	}
+
+	if e := nextEvent(t, events); e.Type != certman.EventWatchStarted {
+		t.Fatalf("unexpected event after load: %+v", e)
+	}
+
+	_, otherKey := certmantest.GeneratePair(t, "other.example.com")
+	copyFile(otherKey, keyFile)
+
+	if e := nextEvent(t, events); e.Type != certman.EventLoadFailed || e.Err == nil {
+		t.Fatalf("unexpected event after mismatched key: %+v", e)
+	}
+
+	cm.Stop()
+
+	if e := nextEvent(t, events); e.Type != certman.EventWatchStopped {
+		t.Fatalf("unexpected event after stop: %+v", e)
+	}
+
+	cancel()
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if e, ok := <-events; ok {
+		t.Fatalf("event sent after cancel: %+v", e)
+	}
+}
+
+func nextEvent(t *testing.T, events <-chan certman.Event) certman.Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+
+	return certman.Event{}
+}
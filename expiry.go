@@ -0,0 +1,58 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/x509"
+	"time"
+)
+
+// expiryInterval is how often the goroutines started by WatchExpiry
+// check the remaining validity of the loaded certificate.
+const expiryInterval = time.Minute
+
+// WatchExpiry starts a goroutine that periodically checks how long
+// the loaded certificate remains valid for and calls fn with the
+// remaining time once it drops below threshold. fn is called once per
+// certificate: a reload resets the check, so fn is called again only
+// if the new certificate is also within threshold of expiring. This
+// makes certman usable as a renewal trigger. The goroutine exits when
+// Stop is called and starts again when Watch is next called.
+func (cm *CertMan) WatchExpiry(threshold time.Duration, fn func(remaining time.Duration)) {
+	reloaded := make(chan struct{}, 1)
+
+	cm.mu.Lock()
+	cm.reloaded = append(cm.reloaded, reloaded)
+	cm.mu.Unlock()
+
+	cm.goSession(func(quit <-chan struct{}) {
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+
+		var notified []byte
+		for {
+			cm.mu.RLock()
+			keyPair := cm.keyPair
+			cm.mu.RUnlock()
+
+			if keyPair != nil && !bytes.Equal(keyPair.Certificate[0], notified) {
+				if leaf, err := x509.ParseCertificate(keyPair.Certificate[0]); err == nil {
+					if remaining := time.Until(leaf.NotAfter); remaining < threshold {
+						notified = keyPair.Certificate[0]
+						fn(remaining)
+					}
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-reloaded:
+			case <-quit:
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestWatchExpiry(t *testing.T) {
+	now := time.Now()
+	certFile, keyFile := certmantest.GeneratePairValidity(t, now, now.Add(time.Hour))
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	expiring := make(chan time.Duration, 10)
+	cm.WatchExpiry(2*time.Hour, func(remaining time.Duration) {
+		expiring <- remaining
+	})
+
+	select {
+	case remaining := <-expiring:
+		if remaining > time.Hour || remaining < 59*time.Minute {
+			t.Fatalf("unexpected remaining validity: %v", remaining)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expiry callback not called")
+	}
+
+	// A certificate outside the threshold resets the check without
+	// calling back.
+	newCert, newKey := certmantest.GeneratePairValidity(t, now, now.Add(3*time.Hour))
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+
+	select {
+	case remaining := <-expiring:
+		t.Fatalf("expiry callback called for certificate with %v remaining", remaining)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	newCert, newKey = certmantest.GeneratePairValidity(t, now, now.Add(90*time.Minute))
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+
+	select {
+	case remaining := <-expiring:
+		if remaining > 90*time.Minute {
+			t.Fatalf("unexpected remaining validity: %v", remaining)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expiry callback not called after reload")
+	}
+}
+
+func TestWatchExpiryExpired(t *testing.T) {
+	certFile, keyFile := certmantest.GenerateExpiredPair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	expiring := make(chan time.Duration, 1)
+	cm.WatchExpiry(time.Hour, func(remaining time.Duration) {
+		expiring <- remaining
+	})
+
+	select {
+	case remaining := <-expiring:
+		if remaining >= 0 {
+			t.Fatalf("expired certificate has %v remaining", remaining)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expiry callback not called for expired certificate")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SetClock replaces the clock certMan uses to decide whether
+// certificates are valid.
+func (cm *CertMan) SetClock(now func() time.Time) {
+	cm.mu.Lock()
+	cm.now = now
+	cm.mu.Unlock()
+}
+
+// SetRewatchDelay sets how long certMan waits between attempts to
+// re-establish a lost watch.
+func (cm *CertMan) SetRewatchDelay(d time.Duration) {
+	cm.mu.Lock()
+	cm.retry = d
+	cm.mu.Unlock()
+}
+
+// InjectEvent passes event to certMan as if from its watcher, for
+// simulating events that can't be caused in tests such as unmounts.
+func (cm *CertMan) InjectEvent(event fsnotify.Event) {
+	cm.currentWatcher().Events <- event
+}
+
+// WatchLimit explains err if it reports the watch limit has been
+// reached.
+var WatchLimit = watchLimit
+
+// HoldLock takes certMan's lock for writing, as swapping in a loaded
+// certificate does, returning a func releasing it.
+func (cm *CertMan) HoldLock() func() {
+	cm.mu.Lock()
+	return cm.mu.Unlock
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspClient is the client used to fetch OCSP responses.
+var ocspClient = &http.Client{Timeout: 10 * time.Second}
+
+// FetchOCSP starts a goroutine that fetches an OCSP response for the
+// served certificate every interval, and whenever it is reloaded, and
+// staples it. The responders listed in the certificate are tried in
+// order and the first response for the certificate is used. If every
+// responder fails the last response fetched continues to be stapled
+// until its NextUpdate, after which nothing is stapled until a
+// responder succeeds again. The issuer must follow the leaf in the
+// chain unless the certificate is self-signed. The goroutine exits
+// when Stop is called and starts again when Watch is next called.
+func (cm *CertMan) FetchOCSP(interval time.Duration) {
+	reloaded := make(chan struct{}, 1)
+
+	cm.mu.Lock()
+	cm.reloaded = append(cm.reloaded, reloaded)
+	cm.mu.Unlock()
+
+	cm.goSession(func(quit <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last, lastLeaf []byte
+		var lastNext time.Time
+
+		due := true
+		for {
+			cm.mu.RLock()
+			keyPair, now := cm.keyPair, cm.now()
+			cm.mu.RUnlock()
+
+			cached := keyPair != nil && bytes.Equal(lastLeaf, keyPair.Certificate[0]) && now.Before(lastNext)
+
+			switch {
+			case keyPair == nil:
+			case due || !bytes.Equal(lastLeaf, keyPair.Certificate[0]):
+				staple, next, url, err := fetchStaple(keyPair)
+				switch {
+				case err == nil:
+					last, lastLeaf, lastNext = staple, keyPair.Certificate[0], next
+					cm.logger().Infof("ocsp response fetched from %s", url)
+				case cached:
+					staple = last
+					cm.logger().Warnf("can't fetch ocsp response, stapling previous response: %v", err)
+				default:
+					last, lastLeaf = nil, keyPair.Certificate[0]
+					cm.logger().Errorf("can't fetch ocsp response: %v", err)
+					if staple = keyPair.OCSPStaple; !now.Before(stapleNextUpdate(staple)) {
+						staple = nil
+					}
+				}
+				cm.setStaple(keyPair, staple)
+			case keyPair.OCSPStaple == nil && cached:
+				// A reload of the same certificate drops the staple.
+				cm.setStaple(keyPair, last)
+			}
+
+			select {
+			case <-ticker.C:
+				due = true
+			case <-reloaded:
+				due = false
+			case <-quit:
+				return
+			}
+		}
+	})
+}
+
+// setStaple staples staple to the served certificate if it is still
+// keyPair, or removes the staple if staple is nil.
+func (cm *CertMan) setStaple(keyPair *tls.Certificate, staple []byte) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.keyPair == nil || !bytes.Equal(cm.keyPair.Certificate[0], keyPair.Certificate[0]) ||
+		bytes.Equal(cm.keyPair.OCSPStaple, staple) {
+		return
+	}
+
+	stapled := *cm.keyPair
+	stapled.OCSPStaple = staple
+	cm.setKeyPair(&stapled)
+}
+
+// fetchStaple fetches an OCSP response for the leaf of keyPair from
+// the responders it lists, returning the response, its NextUpdate and
+// the responder it was fetched from.
+func fetchStaple(keyPair *tls.Certificate) ([]byte, time.Time, string, error) {
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, time.Time{}, "", errors.Wrap(err, "can't parse certificate")
+	}
+
+	issuer := leaf
+	if len(keyPair.Certificate) > 1 {
+		if issuer, err = x509.ParseCertificate(keyPair.Certificate[1]); err != nil {
+			return nil, time.Time{}, "", errors.Wrap(err, "can't parse issuer certificate")
+		}
+	} else if !bytes.Equal(leaf.RawIssuer, leaf.RawSubject) {
+		return nil, time.Time{}, "", errors.New("no issuer certificate in chain")
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		return nil, time.Time{}, "", errors.New("certificate lists no ocsp responders")
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, time.Time{}, "", errors.Wrap(err, "can't create ocsp request")
+	}
+
+	var errs []string
+	for _, url := range leaf.OCSPServer {
+		staple, err := postOCSP(url, req)
+		if err == nil {
+			var resp *ocsp.Response
+			if resp, err = ocsp.ParseResponseForCert(staple, leaf, issuer); err == nil {
+				return staple, resp.NextUpdate, url, nil
+			}
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+	}
+
+	return nil, time.Time{}, "", errors.New(strings.Join(errs, "; "))
+}
+
+// postOCSP posts the OCSP request req to the responder at url and
+// returns the response.
+func postOCSP(url string, req []byte) ([]byte, error) {
+	resp, err := ocspClient.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// stapleNextUpdate returns the NextUpdate of the OCSP response staple,
+// or the zero time if there isn't one or it can't be parsed.
+func stapleNextUpdate(staple []byte) time.Time {
+	if staple == nil {
+		return time.Time{}
+	}
+
+	resp, err := ocsp.ParseResponse(staple, nil)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return resp.NextUpdate
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestFetchOCSP(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var leaf *x509.Certificate
+	nextUpdate := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil || req.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		der, err := ocsp.CreateResponse(leaf, leaf, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: leaf.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   nextUpdate,
+		}, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(der)
+	}))
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{down.URL, up.URL},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePEMFile(t, certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	writePEMFile(t, keyFile, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	cm.FetchOCSP(time.Hour)
+	waitStapled(t, cm, true)
+
+	if status := cm.Status(); !status.StapleNextUpdate.Equal(nextUpdate) {
+		t.Fatalf("staple next update %v, want %v", status.StapleNextUpdate, nextUpdate)
+	}
+
+	// With every responder down the previous response is stapled to
+	// the reloaded certificate until its NextUpdate.
+	up.Close()
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload: %v", err)
+	}
+	waitStapled(t, cm, true)
+}
+
+// waitStapled waits for the served certificate to have a staple, or
+// not, failing the test if it doesn't in time.
+func waitStapled(t *testing.T, cm *certman.CertMan, stapled bool) {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cm.Status().Stapled == stapled && (servedStaple(t, cm) != nil) == stapled {
+			return
+		}
+	}
+
+	t.Fatalf("stapled not %v in time", stapled)
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/pem"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// File formats detected by fileFormat.
+const (
+	formatPEM    = "PEM"
+	formatDER    = "DER"
+	formatPKCS12 = "PKCS#12"
+)
+
+// NewPKCS12 creates a new certMan loading the certificate and key from
+// the PKCS#12 file, decrypted with password. It is New with file as
+// both the certificate and key file and the password set by
+// SetPKCS12Password.
+func NewPKCS12(file, password string) (*CertMan, error) {
+	cm, err := New(file, file)
+	if err != nil {
+		return nil, err
+	}
+	cm.SetPKCS12Password(password)
+
+	return cm, nil
+}
+
+// SetPKCS12Password sets the password used to decrypt certificate and
+// key files detected to be PKCS#12 rather than PEM. Files are detected
+// as PEM, DER or PKCS#12 on each load, so a file's format may change
+// between loads. The default is the empty password.
+func (cm *CertMan) SetPKCS12Password(password string) {
+	cm.mu.Lock()
+	cm.p12Password = password
+	cm.mu.Unlock()
+}
+
+// fileFormat returns the format of the certificate or key file data b.
+func fileFormat(b []byte) string {
+	if bytes.Contains(b, pemBegin) {
+		return formatPEM
+	}
+
+	// A PFX is a sequence starting with version 3, while certificates
+	// start with a sequence and keys with a lower version.
+	var pfx struct {
+		Version int
+		Rest    asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(b, &pfx); err == nil && pfx.Version == 3 {
+		return formatPKCS12
+	}
+
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err == nil {
+		return formatDER
+	}
+
+	return formatPEM
+}
+
+// decodeCert converts the certificates read from certFile to PEM,
+// logging their format if it isn't PEM. DER certificates are converted
+// by normalizeCerts and nothing is converted if PEM is required by
+// SetStrictPEM.
+func (cm *CertMan) decodeCert(certFile string, certPEM []byte) ([]byte, error) {
+	cm.mu.RLock()
+	strict, password := cm.strictPEM, cm.p12Password
+	cm.mu.RUnlock()
+
+	if strict {
+		return certPEM, nil
+	}
+
+	format := fileFormat(certPEM)
+	if format != formatPEM {
+		cm.logger().Infof("detected %s cert file %s", format, certFile)
+	}
+
+	if format != formatPKCS12 {
+		return certPEM, nil
+	}
+
+	certPEM, err := fromPKCS12(certPEM, password, "CERTIFICATE")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode cert file")
+	}
+
+	return certPEM, nil
+}
+
+// decodeKey converts the key read from keyFile to PEM as decodeCert
+// does certificates.
+func (cm *CertMan) decodeKey(keyFile string, keyPEM []byte) ([]byte, error) {
+	cm.mu.RLock()
+	strict, password := cm.strictPEM, cm.p12Password
+	cm.mu.RUnlock()
+
+	if strict {
+		return keyPEM, nil
+	}
+
+	format := fileFormat(keyPEM)
+	if format != formatPEM {
+		cm.logger().Infof("detected %s key file %s", format, keyFile)
+	}
+
+	switch format {
+	case formatPKCS12:
+		keyPEM, err := fromPKCS12(keyPEM, password, "PRIVATE KEY")
+		if err != nil {
+			return nil, errors.Wrap(err, "can't decode key file")
+		}
+		return keyPEM, nil
+	case formatDER:
+		if _, err := parsePrivateKey(keyPEM); err != nil {
+			return nil, errors.Wrap(err, "can't decode key file")
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyPEM}), nil
+	}
+
+	return keyPEM, nil
+}
+
+// fromPKCS12 returns the blocks of the PKCS#12 data p12 with a type
+// ending in blockType, PEM encoded.
+func fromPKCS12(p12 []byte, password, blockType string) ([]byte, error) {
+	blocks, err := pkcs12.ToPEM(p12, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	for _, block := range blocks {
+		if strings.HasSuffix(block.Type, blockType) {
+			pem.Encode(&b, &pem.Block{Type: block.Type, Bytes: block.Bytes})
+		}
+	}
+
+	return b.Bytes(), nil
+}
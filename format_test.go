@@ -0,0 +1,90 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestPKCS12(t *testing.T) {
+	for _, password := range []string{"certman", "wrong"} {
+		buf := new(syncBuffer)
+
+		cm, err := certman.NewPKCS12("./testdata/server1.p12", password)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{buf})
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		cm.Stop()
+
+		if !strings.Contains(buf.String(), "INFO detected PKCS#12 cert file") {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("password %q: format not logged", password)
+		}
+
+		if password == "wrong" {
+			if cm.Status().Loaded {
+				t.Fatalf("loaded with the wrong password")
+			}
+			continue
+		}
+
+		if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+			t.Fatalf("pair in PKCS#12 file not served")
+		}
+	}
+}
+
+func TestDERFiles(t *testing.T) {
+	buf := new(syncBuffer)
+
+	pemCert, pemKey := certmantest.GeneratePair(t, "example.com")
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.der"), filepath.Join(dir, "tls.key.der")
+	for _, f := range [][2]string{{pemCert, certFile}, {pemKey, keyFile}} {
+		b, err := os.ReadFile(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(b)
+		if err := os.WriteFile(f[1], block.Bytes, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	for _, line := range []string{"INFO detected DER cert file", "INFO detected DER key file"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("log from certman doesn't contain %q", line)
+		}
+	}
+
+	if !servedCert(t, cm, pemCert, pemKey) {
+		t.Fatalf("DER pair not served")
+	}
+}
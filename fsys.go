@@ -0,0 +1,59 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"io/fs"
+
+	"github.com/pkg/errors"
+)
+
+// errWatchFS is returned by Watch for a certMan created by NewFromFS.
+var errWatchFS = errors.New("can't watch files in an fs.FS, use Reload")
+
+// NewFromFS creates a new certMan loading the certificate and key
+// from certPath and keyPath in fsys rather than the operating system's
+// file system, for hermetic tests and embedded files. The paths are
+// as accepted by fs.ValidPath. fs.FS has no change notification so
+// Watch returns an error and the pair is loaded by calling Reload.
+// Pairs added with AddPair are still read from the operating system.
+func NewFromFS(fsys fs.FS, certPath, keyPath string) (*CertMan, error) {
+	if fsys == nil {
+		return nil, errors.New("nil fs.FS")
+	}
+
+	if !fs.ValidPath(certPath) {
+		return nil, errors.Errorf("invalid cert path %q", certPath)
+	}
+
+	if !fs.ValidPath(keyPath) {
+		return nil, errors.Errorf("invalid key path %q", keyPath)
+	}
+
+	cm := newCertMan()
+	cm.fsys = fsys
+	cm.certFile = certPath
+	cm.keyFile = keyPath
+	cm.certPath = certPath
+	cm.keyPath = keyPath
+
+	return cm, nil
+}
+
+// loadFS loads the certificate and key from the fs.FS.
+func (cm *CertMan) loadFS() (*tls.Certificate, error) {
+	certPEM, err := readPEM(cm.fsys, cm.certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := readPEM(cm.fsys, cm.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return cm.parseKeyPair(cm.certFile, cm.keyFile, certPEM, keyPEM, nil)
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dyson/certman"
+)
+
+func TestNewFromFS(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, file := range map[string]string{
+		"tls/tls.crt": "./testdata/server1.crt",
+		"tls/tls.key": "./testdata/server1.key",
+	} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys[name] = &fstest.MapFile{Data: b}
+	}
+
+	if _, err := certman.NewFromFS(fsys, "/tls/tls.crt", "tls/tls.key"); err == nil {
+		t.Fatalf("invalid path accepted")
+	}
+
+	cm, err := certman.NewFromFS(fsys, "tls/tls.crt", "tls/tls.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err == nil {
+		t.Fatalf("watching an fs.FS didn't fail")
+	}
+
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload: %v", err)
+	}
+
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("certificate from fs.FS not served")
+	}
+}
@@ -5,6 +5,6 @@ go 1.19
 require (
 	github.com/fsnotify/fsnotify v1.6.0
 	github.com/pkg/errors v0.9.1
+	golang.org/x/crypto v0.14.0
+	golang.org/x/sys v0.13.0
 )
-
-require golang.org/x/sys v0.0.0-20220908164124-27713097b956 // indirect
@@ -0,0 +1,48 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// gzipMagic are the first bytes of a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// readPEM reads a certificate or key file from fsys, or from the
+// operating system if fsys is nil. Files starting with the gzip magic
+// bytes are decompressed, so bundles stored gzipped can be loaded and
+// watched like plain PEM files.
+func readPEM(fsys fs.FS, file string) ([]byte, error) {
+	var b []byte
+	var err error
+	if fsys != nil {
+		b, err = fs.ReadFile(fsys, file)
+	} else {
+		b, err = os.ReadFile(file)
+	}
+	if err != nil || !bytes.HasPrefix(b, gzipMagic) {
+		return b, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't decompress %s", file)
+	}
+	defer r.Close()
+
+	b, err = io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't decompress %s", file)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"compress/gzip"
+	"os"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestGzipPair(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+	certGz, keyGz := gzipFile(t, certFile), gzipFile(t, keyFile)
+
+	cm, err := certman.New(certGz, keyGz)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Fatalf("serving %q, want old.example.com", got)
+	}
+
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	copyFile(gzipFile(t, newCert), certGz)
+	copyFile(gzipFile(t, newKey), keyGz)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after gzipped files changed, want new.example.com", got)
+	}
+}
+
+// gzipFile writes a gzipped copy of file alongside it and returns the
+// copy's path.
+func gzipFile(t *testing.T, file string) string {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(file + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := gzip.NewWriter(f)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
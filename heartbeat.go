@@ -0,0 +1,40 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "time"
+
+// defaultHeartbeatMessage is logged by the heartbeat when no message
+// is set.
+const defaultHeartbeatMessage = "watch loop alive"
+
+// SetHeartbeat sets the watching goroutine to log msg at info level
+// every interval, so that operators can tell it has died when the
+// messages stop. An empty msg logs "watch loop alive". An interval of
+// zero, the default, disables the heartbeat. It takes effect the next
+// time Watch is called.
+func (cm *CertMan) SetHeartbeat(interval time.Duration, msg string) {
+	if msg == "" {
+		msg = defaultHeartbeatMessage
+	}
+
+	cm.mu.Lock()
+	cm.heartbeat = interval
+	cm.heartbeatMsg = msg
+	cm.mu.Unlock()
+}
+
+// heartbeatTicker returns a ticker for the heartbeat and the message
+// to log on each tick, or a nil ticker if the heartbeat is disabled.
+func (cm *CertMan) heartbeatTicker() (*time.Ticker, string) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.heartbeat <= 0 {
+		return nil, ""
+	}
+
+	return time.NewTicker(cm.heartbeat), cm.heartbeatMsg
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestHeartbeat(t *testing.T) {
+	for _, msg := range []string{"", "certman alive"} {
+		buf := new(syncBuffer)
+
+		certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+		cm, err := certman.New(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{buf})
+		cm.SetHeartbeat(20*time.Millisecond, msg)
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		time.Sleep(110 * time.Millisecond)
+		cm.Stop()
+
+		want := "INFO " + msg
+		if msg == "" {
+			want = "INFO watch loop alive"
+		}
+
+		beats := strings.Count(buf.String(), want)
+		if beats < 2 {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("message %q: got %d heartbeats, want at least 2", msg, beats)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		if after := strings.Count(buf.String(), want); after != beats {
+			t.Fatalf("message %q: heartbeat continued after stop", msg)
+		}
+	}
+}
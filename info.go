@@ -0,0 +1,73 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"math/big"
+	"time"
+)
+
+// CertInfo describes the served certificate.
+type CertInfo struct {
+	// Subject and Issuer are the distinguished names of the leaf
+	// certificate's subject and issuer.
+	Subject string
+	Issuer  string
+
+	// NotBefore and NotAfter bound the leaf certificate's validity.
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// DNSNames are the leaf certificate's DNS subject alternative
+	// names.
+	DNSNames []string
+
+	// SerialNumber is the leaf certificate's serial number.
+	SerialNumber *big.Int
+
+	// ChainLength is the number of certificates served, including
+	// the leaf and any intermediates.
+	ChainLength int
+
+	// Fingerprint is the SHA-256 fingerprint of the leaf
+	// certificate.
+	Fingerprint [32]byte
+}
+
+// Info returns a description of the served certificate, or the zero
+// CertInfo if none is loaded.
+func (cm *CertMan) Info() CertInfo {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	info := cm.info
+	info.DNSNames = append([]string(nil), info.DNSNames...)
+	if info.SerialNumber != nil {
+		info.SerialNumber = new(big.Int).Set(info.SerialNumber)
+	}
+
+	return info
+}
+
+// certInfo returns the description of keyPair.
+func certInfo(keyPair *tls.Certificate) CertInfo {
+	info := CertInfo{
+		ChainLength: len(keyPair.Certificate),
+		Fingerprint: sha256.Sum256(keyPair.Certificate[0]),
+	}
+
+	if leaf := keyPair.Leaf; leaf != nil {
+		info.Subject = leaf.Subject.String()
+		info.Issuer = leaf.Issuer.String()
+		info.NotBefore = leaf.NotBefore
+		info.NotAfter = leaf.NotAfter
+		info.DNSNames = leaf.DNSNames
+		info.SerialNumber = leaf.SerialNumber
+	}
+
+	return info
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestInfo(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com", "www.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if info := cm.Info(); info.ChainLength != 0 {
+		t.Fatalf("info before loading: %+v", info)
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	c := leaf(t, certFile)
+	info := cm.Info()
+
+	if info.Subject != c.Subject.String() || info.Issuer != c.Issuer.String() {
+		t.Errorf("subject %q issuer %q, want %q and %q", info.Subject, info.Issuer, c.Subject, c.Issuer)
+	}
+	if !info.NotBefore.Equal(c.NotBefore) || !info.NotAfter.Equal(c.NotAfter) {
+		t.Errorf("validity %v to %v, want %v to %v", info.NotBefore, info.NotAfter, c.NotBefore, c.NotAfter)
+	}
+	if len(info.DNSNames) != 2 || info.DNSNames[0] != "example.com" || info.DNSNames[1] != "www.example.com" {
+		t.Errorf("DNS names %q", info.DNSNames)
+	}
+	if info.SerialNumber.Cmp(c.SerialNumber) != 0 {
+		t.Errorf("serial number %v, want %v", info.SerialNumber, c.SerialNumber)
+	}
+	if info.ChainLength != 1 {
+		t.Errorf("chain length %d, want 1", info.ChainLength)
+	}
+	if info.Fingerprint != sha256.Sum256(c.Raw) {
+		t.Errorf("fingerprint %x doesn't match the leaf", info.Fingerprint)
+	}
+}
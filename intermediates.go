@@ -0,0 +1,171 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// WatchIntermediates loads the PEM encoded certificates in the files
+// of dir and appends those issuing the loaded certificates to the
+// chains served, watching dir for files being added, changed or
+// removed. Each change rebuilds the chains, walking from the last
+// certificate in the certificate file to the certificate in dir that
+// issued it, and so on until a certificate with no issuer in dir.
+// Self-signed roots aren't served. If dir can't be read the previous
+// chains continue to be served.
+func (cm *CertMan) WatchIntermediates(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := readIntermediates(dir); err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	cm.interDir = dir
+	cm.mu.Unlock()
+
+	watcher := cm.currentWatcher()
+	if watcher == nil {
+		return nil
+	}
+
+	if err := addWatch(watcher, dir); err != nil {
+		return errors.Wrap(err, "can't watch intermediates")
+	}
+
+	err = cm.reload()
+	cm.loadPairs(nil)
+
+	return err
+}
+
+// intermediateEvent reports whether event concerns a file in the
+// intermediates directory.
+func (cm *CertMan) intermediateEvent(event fsnotify.Event) bool {
+	cm.mu.RLock()
+	dir := cm.interDir
+	cm.mu.RUnlock()
+
+	return dir != "" && equalPath(filepath.Dir(filepath.Clean(event.Name)), dir)
+}
+
+// addIntermediates appends to the chain of keyPair the intermediates
+// issuing it from the intermediates directory, if one is set. The
+// chain is replaced rather than appended to in place as it may be
+// shared with the parse cache.
+func (cm *CertMan) addIntermediates(keyPair *tls.Certificate) error {
+	cm.mu.RLock()
+	dir := cm.interDir
+	cm.mu.RUnlock()
+
+	if dir == "" {
+		return nil
+	}
+
+	pool, err := readIntermediates(dir)
+	if err != nil {
+		return err
+	}
+
+	chain := append([][]byte(nil), keyPair.Certificate...)
+
+	last := keyPair.Leaf
+	if len(chain) > 1 {
+		if last, err = x509.ParseCertificate(chain[len(chain)-1]); err != nil {
+			return errors.Wrap(err, "can't parse certificate")
+		}
+	}
+
+	for len(chain) <= len(keyPair.Certificate)+len(pool) {
+		issuer := issuerOf(last, pool, chain)
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer.Raw)
+		last = issuer
+	}
+
+	keyPair.Certificate = chain
+
+	return nil
+}
+
+// issuerOf returns the certificate in pool that isn't self-signed or
+// already in chain and issued cert, or nil if there isn't one.
+func issuerOf(cert *x509.Certificate, pool []*x509.Certificate, chain [][]byte) *x509.Certificate {
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return nil
+	}
+
+next:
+	for _, c := range pool {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) || !bytes.Equal(c.RawSubject, cert.RawIssuer) {
+			continue
+		}
+		for _, der := range chain {
+			if bytes.Equal(der, c.Raw) {
+				continue next
+			}
+		}
+		if cert.CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// readIntermediates returns the certificates in the PEM encoded files
+// of dir. Subdirectories and blocks other than certificates are
+// ignored.
+func readIntermediates(dir string) ([]*x509.Certificate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read intermediates")
+	}
+
+	var pool []*x509.Certificate
+	for _, e := range entries {
+		file := filepath.Join(dir, e.Name())
+		if fi, err := os.Stat(file); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read intermediates")
+		}
+
+		for {
+			var block *pem.Block
+			if block, b = pem.Decode(b); block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't parse intermediate in %s", file)
+			}
+			pool = append(pool, c)
+		}
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestWatchIntermediates(t *testing.T) {
+	root, rootKey := issue(t, "root", true, nil, nil)
+	inter, interKey := issue(t, "intermediate", true, root, rootKey)
+	leaf, leafKey := issue(t, "leaf.example.com", false, inter, interKey)
+
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, crt, leaf)
+	writeKey(t, key, leafKey)
+
+	interDir := filepath.Join(t.TempDir(), "intermediates")
+	if err := os.Mkdir(interDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	unrelated, _ := certmantest.GeneratePair(t, "unrelated.test")
+	copyFile(unrelated, filepath.Join(interDir, "unrelated.pem"))
+	writeCert(t, filepath.Join(interDir, "root.pem"), root)
+	writeCert(t, filepath.Join(interDir, "intermediate.pem"), inter)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.WatchIntermediates(interDir); err != nil {
+		t.Fatalf("could not watch intermediates: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if !servedChain(t, cm, leaf, inter) {
+		t.Fatalf("intermediate not appended to served chain")
+	}
+
+	if err := os.Remove(filepath.Join(interDir, "intermediate.pem")); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, cm)
+
+	if !servedChain(t, cm, leaf) {
+		t.Fatalf("removed intermediate still served")
+	}
+
+	writeCert(t, filepath.Join(interDir, "intermediate.pem"), inter)
+	waitReload(t, cm)
+
+	if !servedChain(t, cm, leaf, inter) {
+		t.Fatalf("added intermediate not served")
+	}
+}
+
+func servedChain(t *testing.T, cm *certman.CertMan, want ...*x509.Certificate) bool {
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cert == nil {
+		t.Fatalf("could not get certman certificate: %v", err)
+	}
+
+	if len(cert.Certificate) != len(want) {
+		return false
+	}
+	for i, c := range want {
+		if !bytes.Equal(cert.Certificate[i], c.Raw) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// issue returns a certificate for name signed by parent, or self-signed
+// if parent is nil, along with its key. CA certificates can sign
+// others and leaf certificates have name as their DNS name.
+func issue(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	if ca {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{name}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func writeCert(t *testing.T, file string, cert *x509.Certificate) {
+	writePEMFile(t, file, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func writeKey(t *testing.T, file string, key *ecdsa.PrivateKey) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEMFile(t, file, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func writePEMFile(t *testing.T, file string, block *pem.Block) {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "io"
+
+// SetKeyLogWriter sets the KeyLogWriter of the configs returned from
+// GetTLSConfig and GetConfigForClient, so TLS master secrets are
+// written to w in NSS key log format for decrypting captured traffic
+// with tools such as Wireshark. Anyone able to read w can decrypt the
+// connections, so it should only be used for debugging. A nil w, the
+// default, disables it.
+func (cm *CertMan) SetKeyLogWriter(w io.Writer) {
+	cm.mu.Lock()
+	cm.keyLog = w
+	cm.mu.Unlock()
+
+	if w != nil {
+		cm.logger().Warnf("TLS key logging enabled, connections can be decrypted")
+	}
+}
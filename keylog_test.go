@@ -0,0 +1,50 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/dyson/certman"
+)
+
+func TestKeyLogWriter(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if cfg := cm.GetTLSConfig(); cfg.KeyLogWriter != nil {
+		t.Fatalf("key log writer set by default")
+	}
+
+	var buf syncBuffer
+	cm.SetKeyLogWriter(&buf)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	go func() {
+		defer serverConn.Close()
+		tls.Server(serverConn, cm.GetTLSConfig()).Handshake()
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("could not handshake: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "CLIENT_HANDSHAKE_TRAFFIC_SECRET") {
+		t.Fatalf("key log not written: %q", buf.String())
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A parsedPair is a loaded pair cached by the hash of its files.
+type parsedPair struct {
+	hash    [sha256.Size]byte
+	keyPair *tls.Certificate
+}
+
+// InvalidateCache discards the cached parses of certificate and key
+// files, so they're parsed afresh when next loaded, and re-parses the
+// leaves of the served certificates, for when code outside certMan has
+// modified a parsed certificate. It is safe to call concurrently with
+// serving and loading.
+func (cm *CertMan) InvalidateCache() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.parsed = nil
+
+	for _, p := range cm.pairs {
+		if keyPair := reparse(p.keyPair); keyPair != nil {
+			p.keyPair = keyPair
+		}
+	}
+
+	if keyPair := reparse(cm.keyPair); keyPair != nil {
+		cm.setKeyPair(keyPair)
+	} else {
+		cm.indexNames()
+	}
+}
+
+// reparse returns a copy of keyPair with its leaf parsed afresh, or nil
+// if there is no keyPair or its leaf can't be parsed.
+func reparse(keyPair *tls.Certificate) *tls.Certificate {
+	if keyPair == nil || len(keyPair.Certificate) == 0 {
+		return nil
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil
+	}
+
+	c := *keyPair
+	c.Leaf = leaf
+
+	return &c
+}
+
+// loadKeyPair loads a certificate and key pair and parses its leaf.
+// Gzipped files are decompressed first.
+// If the files are unchanged since they were last loaded the cached
+// parse is reused, which saves parsing large chains on file systems
+// producing many events.
+// If the standard library can't load the pair, for example because
+// the key file holds several keys and the first isn't the one for the
+// certificate, each private key block is tried in turn and the first
+// matching the certificate is used. The standard library's error is
+// returned if no block matches. Intermediates from the directory set
+// by WatchIntermediates are appended to the chain, and the loaded pair
+// must pass the validator, if one is set.
+func (cm *CertMan) loadKeyPair(certFile, keyFile string) (*tls.Certificate, error) {
+	certPEM, err := readPEM(nil, certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := readPEM(nil, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return cm.parseKeyPair(certFile, keyFile, certPEM, keyPEM, nil)
+}
+
+// parseKeyPair parses a certificate and key pair read from the named
+// certificate and key as described for loadKeyPair. leaf, if not nil,
+// is the already parsed leaf certificate provided by a LeafSource.
+func (cm *CertMan) parseKeyPair(certFile, keyFile string, certPEM, keyPEM []byte, leaf *x509.Certificate) (*tls.Certificate, error) {
+	certPEM, keyPEM, err := cm.decodeKeyPair(certFile, keyFile, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey, hash := certFile+"\x00"+keyFile, hashPEM(certPEM, keyPEM)
+
+	if cached := cm.cachedParse(cacheKey, hash); cached != nil {
+		cm.logger().Debugf("%s unchanged, using cached certificate", certFile)
+		keyPair := *cached
+		if err := cm.addIntermediates(&keyPair); err != nil {
+			return nil, err
+		}
+		if err := cm.validate(&keyPair); err != nil {
+			return nil, err
+		}
+		return &keyPair, nil
+	}
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		var n int
+		var matchErr error
+		if keyPair, n, matchErr = matchKey(certPEM, keyPEM); matchErr != nil {
+			return nil, err
+		}
+		cm.logger().Infof("using private key block %d of %s", n, keyFile)
+	}
+
+	if keyPair.Leaf, err = parseLeaf(keyPair.Certificate[0], leaf); err != nil {
+		return nil, err
+	}
+
+	parsed := keyPair
+	if err := cm.addIntermediates(&keyPair); err != nil {
+		return nil, err
+	}
+
+	if err := cm.validate(&keyPair); err != nil {
+		return nil, err
+	}
+
+	cm.storeParse(cacheKey, hash, &parsed)
+
+	return &keyPair, nil
+}
+
+// parseLeaf parses the leaf certificate der, or returns leaf, already
+// parsed, once checked to be der.
+func parseLeaf(der []byte, leaf *x509.Certificate) (*x509.Certificate, error) {
+	if leaf == nil {
+		return x509.ParseCertificate(der)
+	}
+
+	if !bytes.Equal(leaf.Raw, der) {
+		return nil, errors.New("leaf from source doesn't match the certificate")
+	}
+
+	return leaf, nil
+}
+
+// decodeKeyPair converts a certificate and key pair read from the named
+// certificate and key to PEM, whatever their format, decrypting the key
+// and ordering the chain, ready for parsing.
+func (cm *CertMan) decodeKeyPair(certFile, keyFile string, certPEM, keyPEM []byte) ([]byte, []byte, error) {
+	certPEM, err := cm.decodeCerts(certFile, certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if keyPEM, err = cm.decodeKey(keyFile, keyPEM); err != nil {
+		return nil, nil, err
+	}
+
+	if keyPEM, err = cm.decryptKey(keyPEM); err != nil {
+		return nil, nil, err
+	}
+
+	keyLeaf := func(certs []*x509.Certificate) int {
+		return keyCertificate(certs, keyPEM)
+	}
+	if certPEM, err = cm.orderChain(certFile, certPEM, keyLeaf); err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkBlocks(certPEM, keyPEM); err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// decodeCerts converts the certificates read from certFile to PEM,
+// whatever their format, ready for orderChain.
+func (cm *CertMan) decodeCerts(certFile string, certPEM []byte) ([]byte, error) {
+	certPEM, err := cm.decodeCert(certFile, certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return cm.normalizeCerts(certPEM)
+}
+
+// hashPEM returns the hash identifying a parse of the files holding
+// blocks.
+func hashPEM(blocks ...[]byte) [sha256.Size]byte {
+	h := sha256.New()
+	for _, b := range blocks {
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+
+	var hash [sha256.Size]byte
+	copy(hash[:], h.Sum(nil))
+
+	return hash
+}
+
+// cachedParse returns the parse cached for cacheKey, or nil if there
+// isn't one or it was of files with a different hash.
+func (cm *CertMan) cachedParse(cacheKey string, hash [sha256.Size]byte) *tls.Certificate {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	cached, ok := cm.parsed[cacheKey]
+	if !ok || cached.hash != hash {
+		return nil
+	}
+
+	return cached.keyPair
+}
+
+// storeParse caches keyPair as the parse for cacheKey of files with
+// hash.
+func (cm *CertMan) storeParse(cacheKey string, hash [sha256.Size]byte, keyPair *tls.Certificate) {
+	cm.mu.Lock()
+	if cm.parsed == nil {
+		cm.parsed = map[string]parsedPair{}
+	}
+	cm.parsed[cacheKey] = parsedPair{hash, keyPair}
+	cm.mu.Unlock()
+}
+
+// checkBlocks checks that certPEM holds a CERTIFICATE block and keyPEM
+// a private key block, so a certificate and key written to each
+// other's files is reported clearly rather than by the standard
+// library's error.
+func checkBlocks(certPEM, keyPEM []byte) error {
+	certHasCert, certHasKey := blockTypes(certPEM)
+	keyHasCert, keyHasKey := blockTypes(keyPEM)
+
+	switch {
+	case !certHasCert && certHasKey:
+		return errors.New("cert file contains no CERTIFICATE block, did you swap cert and key?")
+	case !certHasCert:
+		return errors.New("cert file contains no CERTIFICATE block")
+	case !keyHasKey && keyHasCert:
+		return errors.New("key file contains no PRIVATE KEY block, did you swap cert and key?")
+	case !keyHasKey:
+		return errors.New("key file contains no PRIVATE KEY block")
+	}
+
+	return nil
+}
+
+// blockTypes reports whether b holds CERTIFICATE and private key PEM
+// blocks.
+func blockTypes(b []byte) (cert, key bool) {
+	for rest := b; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return cert, key
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert = true
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			key = true
+		}
+	}
+}
+
+// matchKey builds a certificate from the certificate blocks in certPEM
+// and the first private key block in keyPEM matching the leaf's public
+// key. It also returns the position of the key block used, counting
+// only private key blocks and starting at one.
+func matchKey(certPEM, keyPEM []byte) (tls.Certificate, int, error) {
+	var keyPair tls.Certificate
+
+	for rest := certPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			keyPair.Certificate = append(keyPair.Certificate, block.Bytes)
+		}
+	}
+
+	if len(keyPair.Certificate) == 0 {
+		return keyPair, 0, errors.New("no certificate block")
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return keyPair, 0, err
+	}
+
+	n := 0
+	for rest := keyPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		n++
+
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		if publicKeyMatches(leaf.PublicKey, key) {
+			keyPair.PrivateKey = key
+			return keyPair, n, nil
+		}
+	}
+
+	return keyPair, 0, errors.New("no private key block matches the certificate")
+}
+
+// parsePrivateKey parses a DER encoded PKCS #1, PKCS #8 or SEC 1
+// private key.
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		switch key := key.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+			return key, nil
+		}
+		return nil, errors.New("unknown private key type in PKCS#8 wrapping")
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("can't parse private key")
+}
+
+// publicKeyMatches reports whether key is the private key for pub.
+func publicKeyMatches(pub crypto.PublicKey, key crypto.PrivateKey) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+
+	return ok && public.Equal(pub)
+}
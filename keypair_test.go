@@ -0,0 +1,191 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestMultipleKeyBlocks(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	_, otherKeyFile := certmantest.GeneratePair(t, "other.example.com")
+
+	keyFile = concatFiles(t, otherKeyFile, keyFile)
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	logWant := "using private key block 2 of " + keyFile + "\n" +
+		"certificate and key loaded\n"
+	if logGot := buf.String(); !strings.HasPrefix(logGot, logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", logGot)
+		t.Fatalf("log from certman not as expected")
+	}
+
+	if !cm.Status().Loaded {
+		t.Fatalf("certificate not loaded")
+	}
+}
+
+func TestNoMatchingKeyBlock(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, _ := certmantest.GeneratePair(t, "example.com")
+	_, otherKeyFile := certmantest.GeneratePair(t, "other.example.com")
+	_, anotherKeyFile := certmantest.GeneratePair(t, "another.example.com")
+
+	keyFile := concatFiles(t, otherKeyFile, anotherKeyFile)
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	logWant := "can't load cert or key file: tls: private key does not match public key\n"
+	if logGot := buf.String(); !strings.HasPrefix(logGot, logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", logGot)
+		t.Fatalf("log from certman not as expected")
+	}
+}
+
+// concatFiles writes the contents of files to a new temporary file
+// and returns its path.
+func concatFiles(t *testing.T, files ...string) string {
+	var b []byte
+	for _, f := range files {
+		c, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, c...)
+	}
+
+	out := filepath.Join(t.TempDir(), "concat.pem")
+	if err := os.WriteFile(out, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func TestParseCache(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load pair: %v", err)
+	}
+	before, _ := cm.GetCertificate(&tls.ClientHelloInfo{})
+
+	// Rewriting identical content reuses the parsed leaf.
+	copyFile(certFile, certFile+".copy")
+	copyFile(certFile+".copy", certFile)
+
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload pair: %v", err)
+	}
+	after, _ := cm.GetCertificate(&tls.ClientHelloInfo{})
+
+	if after.Leaf != before.Leaf {
+		t.Fatalf("unchanged pair was parsed again")
+	}
+
+	newCert, newKey := certmantest.GeneratePair(t, "example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload pair: %v", err)
+	}
+	changed, _ := cm.GetCertificate(&tls.ClientHelloInfo{})
+
+	if changed.Leaf == before.Leaf {
+		t.Fatalf("changed pair wasn't parsed")
+	}
+}
+
+func TestSwappedFiles(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(keyFile, certFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	logWant := "can't load cert or key file: cert file contains no CERTIFICATE block, did you swap cert and key?\n"
+	if logGot := buf.String(); !strings.HasPrefix(logGot, logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", logGot)
+		t.Fatalf("log from certman not as expected")
+	}
+}
+
+func TestInvalidateCache(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(log.New(new(syncBuffer), "", 0))
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("could not get certificate: %v", err)
+	}
+	cert.Leaf.DNSNames = []string{"mutated.example.com"}
+
+	cm.InvalidateCache()
+
+	if got := servedName(t, cm, ""); got != "example.com" {
+		t.Fatalf("serving leaf for %q after invalidating cache, want example.com", got)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// A KeySource provides the private key for a certificate as a
+// crypto.Signer, for keys that can't be read from a file such as those
+// held by a PKCS#11 token or other HSM. Signer is called with the
+// certificate's leaf each time the certificate is loaded, so the
+// source can select the matching key.
+type KeySource interface {
+	Signer(leaf *x509.Certificate) (crypto.Signer, error)
+}
+
+// NewWithKeySource creates a new certMan loading the certificate from
+// certFile, watched for changes as with New, and signing with the key
+// provided by ks rather than read from a key file. Otherwise certMan
+// behaves as one created by New, though the options concerning the key
+// file, such as SetKeyPermissionCheck, have no effect.
+func NewWithKeySource(certFile string, ks KeySource) (*CertMan, error) {
+	if ks == nil {
+		return nil, errors.New("nil key source")
+	}
+
+	cm, err := New(certFile, certFile)
+	if err != nil {
+		return nil, err
+	}
+	cm.keySource = ks
+
+	return cm, nil
+}
+
+// loadKeySource loads the certificate file and gets the signer for its
+// leaf from the key source. The certificate file is decoded, reordered
+// and cached as by loadKeyPair.
+func (cm *CertMan) loadKeySource() (*tls.Certificate, error) {
+	certFile, _ := cm.files()
+
+	certPEM, err := readPEM(nil, certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if certPEM, err = cm.decodeCerts(certFile, certPEM); err != nil {
+		return nil, err
+	}
+
+	if certPEM, err = cm.orderChain(certFile, certPEM, endEntity); err != nil {
+		return nil, err
+	}
+
+	var keyPair tls.Certificate
+	hash := hashPEM(certPEM)
+
+	if cached := cm.cachedParse(certFile, hash); cached != nil {
+		cm.logger().Debugf("%s unchanged, using cached certificate", certFile)
+		keyPair = *cached
+	} else {
+		for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type == "CERTIFICATE" {
+				keyPair.Certificate = append(keyPair.Certificate, block.Bytes)
+			}
+		}
+
+		if len(keyPair.Certificate) == 0 {
+			return nil, errors.New("cert file contains no CERTIFICATE block")
+		}
+
+		if keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0]); err != nil {
+			return nil, err
+		}
+
+		parsed := keyPair
+		cm.storeParse(certFile, hash, &parsed)
+	}
+
+	signer, err := cm.keySource.Signer(keyPair.Leaf)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get signer from key source")
+	}
+
+	pub, ok := keyPair.Leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(signer.Public()) {
+		return nil, errors.New("key source signer doesn't match certificate")
+	}
+	keyPair.PrivateKey = signer
+
+	if err := cm.addIntermediates(&keyPair); err != nil {
+		return nil, err
+	}
+
+	if err := cm.validate(&keyPair); err != nil {
+		return nil, err
+	}
+
+	return &keyPair, nil
+}
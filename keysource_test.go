@@ -0,0 +1,104 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+// signerSource provides a key loaded up front as a signer, as an HSM
+// would without exposing it.
+type signerSource struct {
+	signer crypto.Signer
+}
+
+func (s signerSource) Signer(leaf *x509.Certificate) (crypto.Signer, error) {
+	return s.signer, nil
+}
+
+func TestKeySource(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not load certificate and key: %v", err)
+	}
+
+	cm, err := certman.NewWithKeySource(certFile, signerSource{keyPair.PrivateKey.(crypto.Signer)})
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if !servedCert(t, cm, certFile, keyFile) {
+		t.Fatalf("certificate not served")
+	}
+
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("could not get certificate: %v", err)
+	}
+	if _, ok := cert.PrivateKey.(crypto.Signer); !ok {
+		t.Fatalf("served certificate has no signer")
+	}
+
+	// A certificate for a key the source doesn't provide isn't loaded.
+	origCert := filepath.Join(t.TempDir(), "orig.crt")
+	copyFile(certFile, origCert)
+
+	otherCert, otherKey := certmantest.GeneratePair(t, "other.example.com")
+	copyFile(otherCert, certFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if servedCert(t, cm, otherCert, otherKey) {
+		t.Fatalf("certificate not matching the key source's signer loaded")
+	}
+	if !servedCert(t, cm, origCert, keyFile) {
+		t.Fatalf("previous certificate no longer served")
+	}
+}
+
+func TestKeySourceChainReordering(t *testing.T) {
+	root, rootKey := issue(t, "root", true, nil, nil)
+	inter, interKey := issue(t, "intermediate", true, root, rootKey)
+	leafCert, leafKey := issue(t, "example.com", false, inter, interKey)
+
+	certFile := filepath.Join(t.TempDir(), "tls.crt")
+	writeChain(t, certFile, root, inter, leafCert)
+
+	cm, err := certman.NewWithKeySource(certFile, signerSource{leafKey})
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetChainReordering(true)
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load certificate: %v", err)
+	}
+
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("could not get certificate: %v", err)
+	}
+	for i, c := range []*x509.Certificate{leafCert, inter, root} {
+		if !bytes.Equal(cert.Certificate[i], c.Raw) {
+			t.Fatalf("certificate %d of chain is out of order", i)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// SetMaintenanceCertificate sets a certificate GetCertificate serves to
+// every client, in place of the last one loaded, once loads have been
+// failing for the period set by SetMaintenanceAfter, such as one for a
+// status page host name. It gives a controlled failure mode rather than
+// serving a stale or expired certificate indefinitely. The last loaded
+// certificate is served again as soon as a load succeeds. Switching to
+// and from the maintenance certificate is logged. A nil certificate,
+// the default, disables it.
+func (cm *CertMan) SetMaintenanceCertificate(keyPair *tls.Certificate) {
+	cm.mu.Lock()
+	cm.maintenance = keyPair
+	cm.mu.Unlock()
+}
+
+// SetMaintenanceAfter sets how long loads must have been failing,
+// since the first of the consecutive failures, before the certificate
+// set by SetMaintenanceCertificate is served. A period of zero, the
+// default, serves it as soon as a load fails.
+func (cm *CertMan) SetMaintenanceAfter(d time.Duration) {
+	cm.mu.Lock()
+	cm.maintAfter = d
+	cm.mu.Unlock()
+}
+
+// degraded returns the maintenance certificate if loads have been
+// failing for long enough to serve it, or nil otherwise, logging when
+// that changes.
+func (cm *CertMan) degraded() *tls.Certificate {
+	if !cm.readLock() {
+		return nil
+	}
+	keyPair := cm.maintenance
+	degraded := keyPair != nil && cm.failures > 0 && !cm.now().Before(cm.failedAt.Add(cm.maintAfter))
+	switched := degraded != cm.maintaining
+	cm.mu.RUnlock()
+
+	if switched && cm.writeLock() {
+		switched = degraded != cm.maintaining
+		cm.maintaining = degraded
+		failedAt := cm.failedAt
+		cm.mu.Unlock()
+
+		switch {
+		case switched && degraded:
+			cm.logger().Warnf("loads failing since %s, serving maintenance certificate", failedAt.Format(time.RFC3339))
+		case switched:
+			cm.logger().Infof("load succeeded, leaving maintenance mode")
+		}
+	}
+
+	if !degraded {
+		return nil
+	}
+
+	return keyPair
+}
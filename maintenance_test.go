@@ -0,0 +1,81 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestMaintenanceCertificate(t *testing.T) {
+	buf := new(syncBuffer)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	maintCert, maintKey := certmantest.GeneratePair(t, "status.example.com")
+
+	maintenance, err := tls.LoadX509KeyPair(maintCert, maintKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maintenance.Leaf, err = x509.ParseCertificate(maintenance.Certificate[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	c := newClock()
+	cm.SetClock(c.Now)
+	cm.LeveledLogger(levelLogger{buf})
+	cm.SetMaintenanceCertificate(&maintenance)
+	cm.SetMaintenanceAfter(time.Minute)
+
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load pair: %v", err)
+	}
+
+	copyFile(maintKey, keyFile)
+	if _, err := cm.Reload(); err == nil {
+		t.Fatal("mismatched key loaded")
+	}
+
+	c.Advance(30 * time.Second)
+	if name := servedName(t, cm, ""); name != "example.com" {
+		t.Fatalf("served %s before maintenance period", name)
+	}
+
+	c.Advance(time.Minute)
+	if name := servedName(t, cm, ""); name != "status.example.com" {
+		t.Fatalf("served %s after maintenance period, want maintenance certificate", name)
+	}
+	servedName(t, cm, "")
+
+	if n := strings.Count(buf.String(), "serving maintenance certificate"); n != 1 {
+		t.Log("log output received:", buf.String())
+		t.Fatalf("switch to maintenance logged %d times, want 1", n)
+	}
+
+	copyFile(maintCert, certFile)
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load pair: %v", err)
+	}
+
+	if name := servedName(t, cm, ""); name != "status.example.com" {
+		t.Fatalf("served %s after recovery, want reloaded certificate", name)
+	}
+
+	if !strings.Contains(buf.String(), "INFO load succeeded, leaving maintenance mode") {
+		t.Log("log output received:", buf.String())
+		t.Fatal("switch from maintenance not logged")
+	}
+}
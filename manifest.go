@@ -0,0 +1,171 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// manifestFile is the JSON representation of a manifest file:
+//
+//	{
+//		"pairs": [
+//			{"cert": "default.crt", "key": "default.key"},
+//			{"cert": "api.crt", "key": "api.key", "hosts": ["api.example.com"]}
+//		]
+//	}
+//
+// Relative paths are resolved against the directory of the manifest.
+type manifestFile struct {
+	Pairs []manifestPair `json:"pairs"`
+}
+
+type manifestPair struct {
+	Cert  string   `json:"cert"`
+	Key   string   `json:"key"`
+	Hosts []string `json:"hosts"`
+}
+
+// NewFromManifest creates a new certMan serving the certificate and
+// key pairs listed in the JSON manifest in manifestFile. The first
+// pair is served as if passed to New and the rest as if added with
+// AddPair. A pair listing hosts is served for those names rather than
+// the DNS names in its certificate. The manifest is watched alongside
+// the pairs once Watch is called, and on change pairs after the first
+// are added, removed or updated to match it without a restart. The
+// first pair can't be changed while running. If a changed manifest
+// can't be read or is invalid the previous pairs continue to be used.
+// Manifests are JSON only: YAML would add a dependency on a YAML
+// library for every user of certman, and since JSON is a subset of
+// YAML, tools working in YAML can write the manifest as JSON.
+// Indexes passed to MapCIDR and MapPort refer to the pairs in manifest
+// order when they are mapped.
+func NewFromManifest(manifestFile string) (*CertMan, error) {
+	manifestFile, err := filepath.Abs(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, err := readManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cm, err := New(pairs[0].Cert, pairs[0].Key)
+	if err != nil {
+		return nil, err
+	}
+
+	cm.manifest = manifestFile
+	cm.reconcilePairs(pairs[1:])
+
+	return cm, nil
+}
+
+// readManifest reads and validates the manifest in file, returning
+// its pairs with absolute paths.
+func readManifest(file string) ([]manifestPair, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read manifest file")
+	}
+
+	var mf manifestFile
+	if err := json.Unmarshal(b, &mf); err != nil {
+		return nil, errors.Wrap(err, "can't parse manifest file")
+	}
+
+	if len(mf.Pairs) == 0 {
+		return nil, errors.New("can't parse manifest file: no pairs listed")
+	}
+
+	dir := filepath.Dir(file)
+	for i, p := range mf.Pairs {
+		if p.Cert == "" || p.Key == "" {
+			return nil, errors.Errorf("can't parse manifest file: pair %d needs a cert and key", i)
+		}
+		if !filepath.IsAbs(p.Cert) {
+			mf.Pairs[i].Cert = filepath.Join(dir, p.Cert)
+		}
+		if !filepath.IsAbs(p.Key) {
+			mf.Pairs[i].Key = filepath.Join(dir, p.Key)
+		}
+	}
+
+	return mf.Pairs, nil
+}
+
+// loadManifest rereads the manifest and reconciles the pairs after the
+// first with it, watching and loading any new pairs.
+func (cm *CertMan) loadManifest() error {
+	cm.mu.RLock()
+	manifestFile := cm.manifest
+	cm.mu.RUnlock()
+
+	pairs, err := readManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	if certFile, keyFile := cm.files(); !sameFile(pairs[0].Cert, certFile) || !sameFile(pairs[0].Key, keyFile) {
+		return errors.New("can't change the first pair of the manifest file while running")
+	}
+
+	added := cm.reconcilePairs(pairs[1:])
+
+	if watcher := cm.currentWatcher(); watcher != nil {
+		for _, p := range added {
+			if err := addWatch(watcher, filepath.Dir(p.certFile)); err != nil {
+				return errors.Wrap(err, "can't watch cert file")
+			}
+			if err := addWatch(watcher, filepath.Dir(p.keyFile)); err != nil {
+				return errors.Wrap(err, "can't watch key file")
+			}
+		}
+	}
+
+	b := &batch{}
+	for _, p := range added {
+		b.names = append(b.names, p.certFile)
+	}
+	cm.loadPairs(b)
+	cm.logger().Infof("manifest loaded")
+
+	return nil
+}
+
+// reconcilePairs replaces the pairs added after the first with those
+// in entries, keeping the loaded certificate of pairs that remain, and
+// returns the pairs that are new.
+func (cm *CertMan) reconcilePairs(entries []manifestPair) []*pair {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var pairs, added []*pair
+
+next:
+	for _, e := range entries {
+		for _, p := range cm.pairs {
+			if sameFile(p.certFile, e.Cert) && sameFile(p.keyFile, e.Key) {
+				p.hosts = e.Hosts
+				pairs = append(pairs, p)
+				continue next
+			}
+		}
+
+		p := &pair{certFile: e.Cert, keyFile: e.Key, hosts: e.Hosts}
+		pairs = append(pairs, p)
+		added = append(added, p)
+	}
+
+	cm.pairs = pairs
+	cm.indexNames()
+
+	return added
+}
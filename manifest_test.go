@@ -0,0 +1,175 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestNewFromManifest(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := t.TempDir()
+	for _, host := range []string{"default.test", "api.example.com", "www.example.com"} {
+		crt, key := certmantest.GeneratePair(t, host)
+		copyFile(crt, filepath.Join(dir, host+".crt"))
+		copyFile(key, filepath.Join(dir, host+".key"))
+	}
+
+	manifestFile := filepath.Join(dir, "manifest.json")
+	writeManifest(t, manifestFile, `{"pairs": [
+		{"cert": "default.test.crt", "key": "default.test.key"},
+		{"cert": "api.example.com.crt", "key": "api.example.com.key", "hosts": ["api.example.com", "alias.example.com"]}
+	]}`)
+
+	cm, err := certman.NewFromManifest(manifestFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	tests := map[string]string{
+		"api.example.com":   "api.example.com",
+		"alias.example.com": "api.example.com",
+		"www.example.com":   "default.test",
+	}
+	for serverName, want := range tests {
+		if got := servedName(t, cm, serverName); got != want {
+			t.Errorf("server name %q served %q, want %q", serverName, got, want)
+		}
+	}
+
+	writeManifest(t, manifestFile, `{"pairs": [
+		{"cert": "default.test.crt", "key": "default.test.key"},
+		{"cert": "www.example.com.crt", "key": "www.example.com.key"}
+	]}`)
+	time.Sleep(200 * time.Millisecond)
+
+	tests = map[string]string{
+		"api.example.com": "default.test",
+		"www.example.com": "www.example.com",
+	}
+	for serverName, want := range tests {
+		if got := servedName(t, cm, serverName); got != want {
+			t.Errorf("after manifest change server name %q served %q, want %q", serverName, got, want)
+		}
+	}
+
+	buf.Reset()
+	writeManifest(t, manifestFile, `{"pairs": [{"cert": "www.example.com.crt", "key": "www.example.com.key"}]}`)
+	time.Sleep(200 * time.Millisecond)
+
+	logWant := "ERROR can't load manifest file: can't change the first pair of the manifest file while running"
+	if !strings.Contains(buf.String(), logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", buf.String())
+		t.Fatalf("log from certman not as expected")
+	}
+	if got := servedName(t, cm, "www.example.com"); got != "www.example.com" {
+		t.Fatalf("rejected manifest replaced the previous pairs, served %q", got)
+	}
+}
+
+func TestManifestMappingsFollowPairs(t *testing.T) {
+	dir := t.TempDir()
+	for _, host := range []string{"default.test", "api.example.com", "www.example.com"} {
+		crt, key := certmantest.GeneratePair(t, host)
+		copyFile(crt, filepath.Join(dir, host+".crt"))
+		copyFile(key, filepath.Join(dir, host+".key"))
+	}
+
+	manifestFile := filepath.Join(dir, "manifest.json")
+	writeManifest(t, manifestFile, `{"pairs": [
+		{"cert": "default.test.crt", "key": "default.test.key"},
+		{"cert": "api.example.com.crt", "key": "api.example.com.key"},
+		{"cert": "www.example.com.crt", "key": "www.example.com.key"}
+	]}`)
+
+	cm, err := certman.NewFromManifest(manifestFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	if err := cm.MapPort(8443, 2); err != nil {
+		t.Fatalf("could not map port: %v", err)
+	}
+	if err := cm.MapPort(9443, 1); err != nil {
+		t.Fatalf("could not map port: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	served := func(port int) string {
+		t.Helper()
+
+		cert, err := cm.GetCertificate(&tls.ClientHelloInfo{
+			Conn: localConn{addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: port}},
+		})
+		if err != nil {
+			t.Fatalf("could not get certman certificate: %v", err)
+		}
+		return cert.Leaf.DNSNames[0]
+	}
+
+	if got := served(8443); got != "www.example.com" {
+		t.Fatalf("port 8443 served %q, want %q", got, "www.example.com")
+	}
+
+	// Removing the api pair renumbers the www pair, which stays mapped.
+	writeManifest(t, manifestFile, `{"pairs": [
+		{"cert": "default.test.crt", "key": "default.test.key"},
+		{"cert": "www.example.com.crt", "key": "www.example.com.key"}
+	]}`)
+	time.Sleep(200 * time.Millisecond)
+
+	if got := served(8443); got != "www.example.com" {
+		t.Errorf("after manifest change port 8443 served %q, want %q", got, "www.example.com")
+	}
+	if got := served(9443); got != "default.test" {
+		t.Errorf("after manifest change port mapped to removed pair served %q, want %q", got, "default.test")
+	}
+}
+
+func TestNewFromManifestInvalid(t *testing.T) {
+	manifestFile := filepath.Join(t.TempDir(), "manifest.json")
+
+	for manifest, want := range map[string]string{
+		`{"pairs": []}`:              "can't parse manifest file: no pairs listed",
+		`{"pairs": [{"cert": "a"}]}`: "can't parse manifest file: pair 0 needs a cert and key",
+		`{`:                          "can't parse manifest file:",
+	} {
+		writeManifest(t, manifestFile, manifest)
+		if _, err := certman.NewFromManifest(manifestFile); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("manifest %s: unexpected error: %v", manifest, err)
+		}
+	}
+}
+
+func writeManifest(t *testing.T, manifestFile, manifest string) {
+	tmp := manifestFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, manifestFile); err != nil {
+		t.Fatal(err)
+	}
+}
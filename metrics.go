@@ -0,0 +1,57 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "time"
+
+// Metrics is implemented by metrics systems certMan pushes to, such as
+// an adapter to Prometheus or OpenTelemetry instruments. Its methods
+// are called from whichever goroutine loaded the files, without
+// certMan's locks held, so must be safe for concurrent use.
+type Metrics interface {
+	// IncReload is called for each successful load of the
+	// certificate and key.
+	IncReload()
+
+	// IncError is called for each failed load and each error from
+	// the watcher.
+	IncError()
+
+	// ObserveReloadLatency is called with how long each load took,
+	// whether it succeeded or not.
+	ObserveReloadLatency(time.Duration)
+
+	// SetExpiry is called with the NotAfter of the served
+	// certificate after each successful load.
+	SetExpiry(time.Time)
+}
+
+// SetMetrics sets the metrics certMan pushes load outcomes to, in
+// place of polling Stats and Status. A nil m, like the default,
+// discards them. It is safe to call while watching.
+func (cm *CertMan) SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+
+	cm.mu.Lock()
+	cm.metrics = m
+	cm.mu.Unlock()
+}
+
+// metricsSink returns the metrics set by SetMetrics.
+func (cm *CertMan) metricsSink() Metrics {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.metrics
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncReload()                         {}
+func (nopMetrics) IncError()                          {}
+func (nopMetrics) ObserveReloadLatency(time.Duration) {}
+func (nopMetrics) SetExpiry(time.Time)                {}
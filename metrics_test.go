@@ -0,0 +1,80 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+type testMetrics struct {
+	mu        sync.Mutex
+	reloads   int
+	errors    int
+	latencies []time.Duration
+	expiry    time.Time
+}
+
+func (m *testMetrics) IncReload() {
+	m.mu.Lock()
+	m.reloads++
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) IncError() {
+	m.mu.Lock()
+	m.errors++
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) ObserveReloadLatency(d time.Duration) {
+	m.mu.Lock()
+	m.latencies = append(m.latencies, d)
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) SetExpiry(t time.Time) {
+	m.mu.Lock()
+	m.expiry = t
+	m.mu.Unlock()
+}
+
+func TestSetMetrics(t *testing.T) {
+	notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	certFile, keyFile := certmantest.GeneratePairValidity(t, time.Now().Add(-time.Hour), notAfter, "example.com")
+	_, otherKey := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	m := &testMetrics{}
+	cm.SetMetrics(m)
+
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load pair: %v", err)
+	}
+
+	copyFile(otherKey, keyFile)
+	if _, err := cm.Reload(); err == nil {
+		t.Fatal("mismatched key loaded")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.reloads != 1 || m.errors != 1 || len(m.latencies) != 2 {
+		t.Fatalf("want 1 reload, 1 error and 2 latencies, got %d, %d and %v", m.reloads, m.errors, m.latencies)
+	}
+
+	if !m.expiry.Equal(notAfter) {
+		t.Fatalf("expiry set to %v, want %v", m.expiry, notAfter)
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// A pair is an additional certificate and key pair served to
+// clients requesting one of the names in its certificate.
+type pair struct {
+	certFile string
+	keyFile  string
+	keyPair  *tls.Certificate
+
+	// handshakes counts the handshakes served the pair.
+	handshakes atomic.Uint64
+
+	// hosts, if set, are the names the pair is served for in place of
+	// the DNS names in its certificate.
+	hosts []string
+}
+
+// AddPair adds a certificate and key pair to be watched and served
+// alongside the pair passed to New. Each handshake is served the
+// loaded certificate whose DNS names match the server name requested
+// by the client: an exact match is preferred over a wildcard match,
+// and if neither match, or the client doesn't use SNI, the pair passed
+// to New is served. Among pairs matching equally, such as an RSA and
+// an ECDSA certificate for the same host, the first the client
+// supports by its cipher suites and signature algorithms is served,
+// preferring the pair passed to New and then the earliest added.
+func (cm *CertMan) AddPair(certFile, keyFile string) error {
+	certFile, err := filepath.Abs(certFile)
+	if err != nil {
+		return err
+	}
+
+	keyFile, err = filepath.Abs(keyFile)
+	if err != nil {
+		return err
+	}
+
+	p := &pair{certFile: certFile, keyFile: keyFile}
+
+	cm.mu.Lock()
+	cm.pairs = append(cm.pairs, p)
+	cm.mu.Unlock()
+
+	watcher := cm.currentWatcher()
+	if watcher == nil {
+		return nil
+	}
+
+	if err := addWatch(watcher, filepath.Dir(certFile)); err != nil {
+		return errors.Wrap(err, "can't watch cert file")
+	}
+
+	if err := addWatch(watcher, filepath.Dir(keyFile)); err != nil {
+		return errors.Wrap(err, "can't watch key file")
+	}
+
+	cm.loadPairs(nil)
+
+	return nil
+}
+
+// loadPairs loads the pairs added with AddPair that have files in the
+// batch b, or every pair if b is nil. A pair that fails to load
+// continues to serve its previously loaded certificate, if any.
+func (cm *CertMan) loadPairs(b *batch) {
+	cm.mu.RLock()
+	pairs := append([]*pair(nil), cm.pairs...)
+	cm.mu.RUnlock()
+
+	for _, p := range pairs {
+		if b != nil && !b.all && !b.has(p.certFile) && !b.has(p.keyFile) {
+			continue
+		}
+
+		cm.loadPair(p)
+	}
+
+	cm.mu.Lock()
+	cm.indexNames()
+	cm.mu.Unlock()
+}
+
+// loadPair loads the pair p, logging and returning any error.
+func (cm *CertMan) loadPair(p *pair) error {
+	err := cm.checkKeyPermissions(p.keyFile)
+
+	var keyPair *tls.Certificate
+	if err == nil {
+		keyPair, err = cm.loadKeyPair(p.certFile, p.keyFile)
+	}
+	if err == nil {
+		cm.mu.RLock()
+		old := p.keyPair
+		cm.mu.RUnlock()
+
+		err = cm.checkLoaded(old, keyPair)
+	}
+	if err != nil {
+		cm.logger().Errorf("can't load cert or key file %s: %v", p.certFile, err)
+		cm.emit(sinkLoadFailed, p.certFile, nil, err)
+		return err
+	}
+
+	cm.warnCommonName(p.certFile, keyPair)
+
+	cm.mu.Lock()
+	prev := p.keyPair
+	p.keyPair = keyPair
+	cm.mu.Unlock()
+	cm.logger().Infof("certificate and key loaded: %s", p.certFile)
+	cm.logRotation(p.certFile, prev, keyPair)
+	cm.emit(sinkLoaded, p.certFile, keyPair.Certificate[0], nil)
+
+	return nil
+}
+
+// pairAt returns the pair at index as numbered for MapCIDR and MapPort,
+// nil for index 0, the pair passed to New. cm.mu must be held.
+func (cm *CertMan) pairAt(index int) *pair {
+	if index == 0 {
+		return nil
+	}
+
+	return cm.pairs[index-1]
+}
+
+// mapped returns the loaded certificate of p, a pair mapped by MapCIDR
+// or MapPort, nil being the pair passed to New. It returns nil if p
+// isn't loaded or has since been removed by a manifest reload. cm.mu
+// must be held.
+func (cm *CertMan) mapped(p *pair) *tls.Certificate {
+	if p == nil {
+		return cm.keyPair
+	}
+
+	for _, q := range cm.pairs {
+		if q == p {
+			return p.keyPair
+		}
+	}
+
+	return nil
+}
+
+// pairEvent reports whether event concerns the files of a pair added
+// with AddPair.
+func (cm *CertMan) pairEvent(event fsnotify.Event) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	for _, p := range cm.pairs {
+		if sameFile(event.Name, p.certFile) || sameFile(event.Name, p.keyFile) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A nameIndex maps the DNS names of the loaded certificates to the
+// certificates to serve for them, in order of precedence, so a
+// handshake doesn't scan every loaded certificate.
+type nameIndex struct {
+	exact    map[string][]*tls.Certificate
+	wildcard map[string][]*tls.Certificate
+
+	// supports caches hello.SupportsCertificate results for the
+	// indexed certificates, so it's rebuilt with them on each load.
+	mu      sync.Mutex
+	support map[supportKey]bool
+}
+
+// A supportKey identifies a certificate and the client capabilities
+// that decide whether the client supports it. The server's tls.Config
+// also plays a part, so the cache assumes one is used per certMan.
+type supportKey struct {
+	cert  *tls.Certificate
+	hello string
+}
+
+// maxSupports bounds the cached support results, since clients choose
+// their capabilities. The cache is emptied when it's reached.
+const maxSupports = 1024
+
+// indexNames rebuilds the index of the loaded certificates, and the
+// handshake counter of each, and the snapshot they are served from.
+// Pairs are indexed in order of precedence. cm.mu must be held for
+// writing.
+func (cm *CertMan) indexNames() {
+	index := &nameIndex{
+		exact:    map[string][]*tls.Certificate{},
+		wildcard: map[string][]*tls.Certificate{},
+	}
+
+	add := func(c *tls.Certificate, hosts []string) {
+		for _, n := range hosts {
+			n = strings.ToLower(n)
+
+			names := index.exact
+			if strings.HasPrefix(n, "*.") {
+				names = index.wildcard
+			}
+			names[n] = append(names[n], c)
+		}
+	}
+
+	if cm.keyPair != nil {
+		add(cm.keyPair, cm.leafNames(cm.keyPair.Leaf))
+	}
+	for _, p := range cm.pairs {
+		if p.keyPair == nil {
+			continue
+		}
+		if p.hosts != nil {
+			add(p.keyPair, p.hosts)
+		} else {
+			add(p.keyPair, cm.leafNames(p.keyPair.Leaf))
+		}
+	}
+
+	cm.index = index
+
+	cm.counters = map[*tls.Certificate]*atomic.Uint64{}
+	if cm.keyPair != nil {
+		cm.counters[cm.keyPair] = &cm.handshakes
+	}
+	for _, p := range cm.pairs {
+		if p.keyPair != nil {
+			cm.counters[p.keyPair] = &p.handshakes
+		}
+	}
+
+	cm.storeSnapshot()
+}
+
+// selectCertificate returns the loaded certificate to serve for the
+// server name requested by hello.
+func (s *serveState) selectCertificate(hello *tls.ClientHelloInfo) *tls.Certificate {
+	if s.index == nil {
+		return s.keyPair
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if c, ok := s.index.exact[name]; ok {
+		return s.index.supported(hello, c)
+	}
+
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if c, ok := s.index.wildcard["*"+name[i:]]; ok {
+			return s.index.supported(hello, c)
+		}
+	}
+
+	return s.keyPair
+}
+
+// supported returns the first of the certificates, loaded for the
+// same name, that the client sending hello supports, so an ECDSA
+// certificate can be served to clients supporting it and an RSA one
+// to the rest. If the client supports none of them the first is
+// returned. Results are cached by certificate and client capabilities.
+func (index *nameIndex) supported(hello *tls.ClientHelloInfo, certs []*tls.Certificate) *tls.Certificate {
+	if len(certs) > 1 {
+		key := helloKey(hello)
+		for _, c := range certs {
+			if index.supports(hello, supportKey{c, key}) {
+				return c
+			}
+		}
+	}
+
+	return certs[0]
+}
+
+// supports reports whether the client sending hello supports the
+// certificate in k, using the cached result if there is one.
+func (index *nameIndex) supports(hello *tls.ClientHelloInfo, k supportKey) bool {
+	index.mu.Lock()
+	ok, cached := index.support[k]
+	index.mu.Unlock()
+
+	if cached {
+		return ok
+	}
+
+	ok = hello.SupportsCertificate(k.cert) == nil
+
+	index.mu.Lock()
+	if index.support == nil || len(index.support) >= maxSupports {
+		index.support = map[supportKey]bool{}
+	}
+	index.support[k] = ok
+	index.mu.Unlock()
+
+	return ok
+}
+
+// helloKey encodes the capabilities of the client sending hello that
+// hello.SupportsCertificate depends on.
+func helloKey(hello *tls.ClientHelloInfo) string {
+	var b strings.Builder
+
+	put := func(vs ...uint16) {
+		b.WriteByte(byte(len(vs) >> 8))
+		b.WriteByte(byte(len(vs)))
+		for _, v := range vs {
+			b.WriteByte(byte(v >> 8))
+			b.WriteByte(byte(v))
+		}
+	}
+
+	put(hello.SupportedVersions...)
+	put(hello.CipherSuites...)
+
+	schemes := make([]uint16, len(hello.SignatureSchemes))
+	for i, s := range hello.SignatureSchemes {
+		schemes[i] = uint16(s)
+	}
+	put(schemes...)
+
+	curves := make([]uint16, len(hello.SupportedCurves))
+	for i, c := range hello.SupportedCurves {
+		curves[i] = uint16(c)
+	}
+	put(curves...)
+
+	b.Write(hello.SupportedPoints)
+
+	return b.String()
+}
+
+// HandshakeCounts returns the number of handshakes served each
+// certificate by GetCertificate since certMan was created, keyed by
+// certificate file. Pairs that haven't been served are included with
+// a count of zero, revealing certificates no client uses.
+func (cm *CertMan) HandshakeCounts() map[string]uint64 {
+	certFile, _ := cm.files()
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	counts := map[string]uint64{certFile: cm.handshakes.Load()}
+	for _, p := range cm.pairs {
+		counts[p.certFile] = p.handshakes.Load()
+	}
+
+	return counts
+}
+
+// countHandshake counts a handshake served keyPair.
+func (s *serveState) countHandshake(keyPair *tls.Certificate) {
+	if c := s.counters[keyPair]; c != nil {
+		c.Add(1)
+	}
+}
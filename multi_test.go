@@ -0,0 +1,317 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestAddPairPrecedence(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "default.test")
+	wildcardCert, wildcardKey := certmantest.GeneratePair(t, "*.example.com")
+	exactCert, exactKey := certmantest.GeneratePair(t, "api.example.com")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	// The wildcard is added first so precedence can't come from order.
+	if err := cm.AddPair(wildcardCert, wildcardKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if err := cm.AddPair(exactCert, exactKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"api.example.com", "api.example.com"},
+		{"API.Example.com.", "api.example.com"},
+		{"www.example.com", "*.example.com"},
+		{"example.com", "default.test"},
+		{"a.b.example.com", "default.test"},
+		{"default.test", "default.test"},
+		{"", "default.test"},
+	}
+
+	for _, tt := range tests {
+		if got := servedName(t, cm, tt.serverName); got != tt.want {
+			t.Errorf("server name %q served %q, want %q", tt.serverName, got, tt.want)
+		}
+	}
+}
+
+func TestAddPairReload(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "default.test")
+	pairCert, pairKey := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.AddPair(pairCert, pairKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	copyFile(newCert, pairCert)
+	copyFile(newKey, pairKey)
+	time.Sleep(200 * time.Millisecond)
+
+	if got := servedName(t, cm, "new.example.com"); got != "new.example.com" {
+		t.Fatalf("reloaded pair not served, got %q", got)
+	}
+	if got := servedName(t, cm, "old.example.com"); got != "default.test" {
+		t.Fatalf("replaced pair still served, got %q", got)
+	}
+}
+
+// servedName returns the first DNS name of the certificate cm serves
+// for serverName.
+func TestAddPairReloadsOnlyChangedPair(t *testing.T) {
+	buf := new(syncBuffer)
+
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "default.test")
+	changedCert, changedKey := certmantest.GeneratePair(t, "changed.example.com")
+	untouchedCert, untouchedKey := certmantest.GeneratePair(t, "untouched.example.com")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	for _, p := range [][2]string{{changedCert, changedKey}, {untouchedCert, untouchedKey}} {
+		if err := cm.AddPair(p[0], p[1]); err != nil {
+			t.Fatalf("could not add pair: %v", err)
+		}
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	buf.Reset()
+	newCert, newKey := certmantest.GeneratePair(t, "renewed.example.com")
+	copyFile(newCert, changedCert)
+	copyFile(newKey, changedKey)
+	time.Sleep(200 * time.Millisecond)
+
+	logGot := buf.String()
+	if !strings.Contains(logGot, "INFO certificate and key loaded: "+changedCert) {
+		t.Log("log output received:", logGot)
+		t.Fatalf("changed pair not reloaded")
+	}
+	for _, file := range []string{defaultCert, untouchedCert} {
+		if strings.Contains(logGot, file) {
+			t.Log("log output received:", logGot)
+			t.Fatalf("untouched pair %s re-read", file)
+		}
+	}
+	if strings.Contains(logGot, "INFO certificate and key loaded\n") {
+		t.Log("log output received:", logGot)
+		t.Fatalf("untouched default pair re-read")
+	}
+
+	if got := servedName(t, cm, "renewed.example.com"); got != "renewed.example.com" {
+		t.Fatalf("changed pair not served, got %q", got)
+	}
+	if got := servedName(t, cm, "untouched.example.com"); got != "untouched.example.com" {
+		t.Fatalf("untouched pair not served, got %q", got)
+	}
+}
+
+func TestHandshakeCounts(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "default.test")
+	usedCert, usedKey := certmantest.GeneratePair(t, "used.example.com")
+	unusedCert, unusedKey := certmantest.GeneratePair(t, "unused.example.com")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	for _, p := range [][2]string{{usedCert, usedKey}, {unusedCert, unusedKey}} {
+		if err := cm.AddPair(p[0], p[1]); err != nil {
+			t.Fatalf("could not add pair: %v", err)
+		}
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	for _, serverName := range []string{"used.example.com", "used.example.com", "unknown.test", ""} {
+		servedName(t, cm, serverName)
+	}
+
+	// A renewed certificate keeps counting for its pair.
+	newCert, newKey := certmantest.GeneratePair(t, "used.example.com")
+	copyFile(newCert, usedCert)
+	copyFile(newKey, usedKey)
+	time.Sleep(200 * time.Millisecond)
+	servedName(t, cm, "used.example.com")
+
+	want := map[string]uint64{defaultCert: 2, usedCert: 3, unusedCert: 0}
+	if got := cm.HandshakeCounts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("handshake counts %v, want %v", got, want)
+	}
+}
+
+func servedName(t *testing.T, cm *certman.CertMan, serverName string) string {
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil || cert == nil {
+		t.Fatalf("could not get certman certificate for %q: %v", serverName, err)
+	}
+
+	return cert.Leaf.DNSNames[0]
+}
+
+func TestKeyTypeSelection(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "default.test")
+	rsaCert, rsaKey := generateRSAPair(t, "example.com")
+	ecdsaCert, ecdsaKey := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	// The RSA pair is added first so ECDSA can't be chosen by order.
+	for _, p := range [][2]string{{rsaCert, rsaKey}, {ecdsaCert, ecdsaKey}} {
+		if err := cm.AddPair(p[0], p[1]); err != nil {
+			t.Fatalf("could not add pair: %v", err)
+		}
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	tests := []struct {
+		hello *tls.ClientHelloInfo
+		want  string
+	}{
+		{&tls.ClientHelloInfo{
+			ServerName:        "example.com",
+			CipherSuites:      []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			SupportedVersions: []uint16{tls.VersionTLS12},
+			SupportedCurves:   []tls.CurveID{tls.CurveP256},
+			SupportedPoints:   []uint8{0},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		}, "ECDSA"},
+		{&tls.ClientHelloInfo{
+			ServerName:        "example.com",
+			CipherSuites:      []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			SupportedVersions: []uint16{tls.VersionTLS12},
+			SupportedCurves:   []tls.CurveID{tls.CurveP256},
+			SupportedPoints:   []uint8{0},
+			SignatureSchemes:  []tls.SignatureScheme{tls.PKCS1WithSHA256},
+		}, "RSA"},
+	}
+
+	// Each client is served twice, the second time from cached results.
+	for i := 0; i < 2; i++ {
+		for _, tt := range tests {
+			cert, err := cm.GetCertificate(tt.hello)
+			if err != nil {
+				t.Fatalf("could not get certificate: %v", err)
+			}
+			if got := cert.Leaf.PublicKeyAlgorithm.String(); got != tt.want {
+				t.Errorf("cipher suites %x: served %s certificate, want %s", tt.hello.CipherSuites, got, tt.want)
+			}
+		}
+	}
+}
+
+// generateRSAPair writes a self-signed RSA certificate and key for
+// host to a temporary directory and returns the paths of the files.
+func generateRSAPair(t *testing.T, host string) (certFile, keyFile string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePEMFile(t, certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	writePEMFile(t, keyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return certFile, keyFile
+}
+
+func BenchmarkGetCertificateManyPairs(b *testing.B) {
+	defaultCert, defaultKey := certmantest.GeneratePair(b, "default.test")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		b.Fatalf("could not create certman: %v", err)
+	}
+
+	for i := 0; i < 500; i++ {
+		crt, key := certmantest.GeneratePair(b, fmt.Sprintf("host%d.example.com", i), fmt.Sprintf("*.host%d.example.net", i))
+		if err := cm.AddPair(crt, key); err != nil {
+			b.Fatalf("could not add pair: %v", err)
+		}
+	}
+	if err := cm.Watch(); err != nil {
+		b.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	hellos := []*tls.ClientHelloInfo{
+		{ServerName: "host499.example.com"},
+		{ServerName: "www.host499.example.net"},
+		{ServerName: "unknown.example.org"},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cm.GetCertificate(hellos[i%len(hellos)]); err != nil {
+			b.Fatalf("could not get certificate: %v", err)
+		}
+	}
+}
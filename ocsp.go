@@ -0,0 +1,152 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// WatchOCSP loads the DER encoded OCSP response in ocspFile and
+// staples it to the served certificate, watching the file for
+// changes alongside the certificate and key files. This suits setups
+// where a sidecar fetches OCSP responses and writes them to disk.
+// Responses that don't match the serial number of the loaded
+// certificate are rejected and the previous response, if any,
+// continues to be stapled. Once the stapled response is past its
+// NextUpdate it is no longer stapled until the file is updated.
+func (cm *CertMan) WatchOCSP(ocspFile string) error {
+	ocspFile, err := filepath.Abs(ocspFile)
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	cm.ocspFile = ocspFile
+	loaded := cm.keyPair != nil
+	cm.mu.Unlock()
+
+	if loaded {
+		if err := cm.loadOCSP(); err != nil {
+			return err
+		}
+	}
+
+	if watcher := cm.currentWatcher(); watcher != nil {
+		if err := addWatch(watcher, filepath.Dir(ocspFile)); err != nil {
+			return errors.Wrap(err, "can't watch ocsp file")
+		}
+	}
+
+	return nil
+}
+
+// loadOCSP staples the response in the OCSP file to the currently
+// loaded certificate. The file is read and checked without cm.mu held,
+// so slow storage doesn't stall handshakes, and read again if the
+// certificate changes meanwhile.
+func (cm *CertMan) loadOCSP() error {
+	for {
+		cm.mu.RLock()
+		ocspFile, keyPair := cm.ocspFile, cm.keyPair
+		cm.mu.RUnlock()
+
+		if keyPair == nil {
+			return errors.New("no certificate loaded to staple")
+		}
+
+		staple, err := readStaple(ocspFile, keyPair)
+		if err != nil {
+			return err
+		}
+
+		cm.mu.Lock()
+		current := cm.keyPair
+		stapled := bytes.Equal(current.Certificate[0], keyPair.Certificate[0])
+		if stapled {
+			keyPair := *current
+			keyPair.OCSPStaple = staple
+			cm.setKeyPair(&keyPair)
+		}
+		cm.mu.Unlock()
+
+		if stapled {
+			cm.logger().Infof("ocsp response loaded")
+			return nil
+		}
+	}
+}
+
+// dropStaleStaple stops stapling the OCSP response to the served
+// certificate once it is past its NextUpdate, as some clients reject
+// expired responses, whether it was loaded from the OCSP file or
+// fetched by FetchOCSP and not since refreshed. A fresh response is
+// stapled again when it is loaded or fetched.
+func (cm *CertMan) dropStaleStaple() {
+	if !cm.readLock() {
+		return
+	}
+	stale := cm.staleStaple()
+	cm.mu.RUnlock()
+
+	if !stale || !cm.writeLock() {
+		return
+	}
+	next := cm.stapleNext
+	stale = cm.staleStaple()
+	if stale {
+		keyPair := *cm.keyPair
+		keyPair.OCSPStaple = nil
+		cm.setKeyPair(&keyPair)
+	}
+	cm.mu.Unlock()
+
+	if stale {
+		cm.logger().Warnf("ocsp response expired at %s, no longer stapling it", next.Format(time.RFC3339))
+	}
+}
+
+// staleStaple reports whether the OCSP response stapled to the served
+// certificate is past its NextUpdate. Responses without one are never
+// stale. cm.mu must be held for reading.
+func (cm *CertMan) staleStaple() bool {
+	return cm.keyPair != nil && cm.keyPair.OCSPStaple != nil &&
+		!cm.stapleNext.IsZero() && !cm.now().Before(cm.stapleNext)
+}
+
+// readStaple reads the OCSP response in ocspFile and checks it is for
+// the leaf of keyPair. If keyPair includes the issuing certificate the
+// response's signature is also checked.
+func readStaple(ocspFile string, keyPair *tls.Certificate) ([]byte, error) {
+	staple, err := os.ReadFile(ocspFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read ocsp file")
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse certificate")
+	}
+
+	var issuer *x509.Certificate
+	if len(keyPair.Certificate) > 1 {
+		if issuer, err = x509.ParseCertificate(keyPair.Certificate[1]); err != nil {
+			return nil, errors.Wrap(err, "can't parse issuer certificate")
+		}
+	}
+
+	if _, err := ocsp.ParseResponseForCert(staple, leaf, issuer); err != nil {
+		return nil, errors.Wrap(err, "can't use ocsp response")
+	}
+
+	return staple, nil
+}
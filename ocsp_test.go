@@ -0,0 +1,177 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestWatchOCSP(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	ocspFile := filepath.Join(t.TempDir(), "server.ocsp")
+	good := ocspResponse(t, "./testdata/server1.crt", "./testdata/server1.key")
+	writeOCSP(t, ocspFile, good)
+
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	if err := cm.WatchOCSP(ocspFile); err != nil {
+		t.Fatalf("could not watch ocsp file: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if staple := servedStaple(t, cm); !bytes.Equal(staple, good) {
+		t.Fatalf("served staple doesn't match ocsp file")
+	}
+
+	buf.Reset()
+	writeOCSP(t, ocspFile, ocspResponse(t, "./testdata/server2.crt", "./testdata/server2.key"))
+	time.Sleep(200 * time.Millisecond)
+
+	logWant := "can't load ocsp file: can't use ocsp response:"
+	if !strings.Contains(buf.String(), logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", buf.String())
+		t.Fatalf("log from certman not as expected")
+	}
+
+	if staple := servedStaple(t, cm); !bytes.Equal(staple, good) {
+		t.Fatalf("mismatched ocsp response replaced the previous staple")
+	}
+}
+
+func TestWatchOCSPAfterWatch(t *testing.T) {
+	ocspFile := filepath.Join(t.TempDir(), "server.ocsp")
+	writeOCSP(t, ocspFile, ocspResponse(t, "./testdata/server2.crt", "./testdata/server2.key"))
+
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	err = cm.WatchOCSP(ocspFile)
+	if err == nil || !strings.HasPrefix(err.Error(), "can't use ocsp response:") {
+		t.Fatalf("unexpected watch ocsp error: %v", err)
+	}
+
+	if staple := servedStaple(t, cm); staple != nil {
+		t.Fatalf("mismatched ocsp response was stapled")
+	}
+}
+
+func servedStaple(t *testing.T, cm *certman.CertMan) []byte {
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cert == nil {
+		t.Fatalf("could not get certman certificate: %v", err)
+	}
+
+	return cert.OCSPStaple
+}
+
+// ocspResponse returns a good OCSP response for the self signed
+// certificate crt, signed by itself.
+func ocspResponse(t *testing.T, crt, key string) []byte {
+	keyPair, err := tls.LoadX509KeyPair(crt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := ocsp.CreateResponse(leaf, leaf, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now(),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, keyPair.PrivateKey.(crypto.Signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func writeOCSP(t *testing.T, ocspFile string, der []byte) {
+	tmp := ocspFile + ".tmp"
+	if err := os.WriteFile(tmp, der, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, ocspFile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleOCSPDropped(t *testing.T) {
+	buf := new(syncBuffer)
+
+	ocspFile := filepath.Join(t.TempDir(), "server.ocsp")
+	writeOCSP(t, ocspFile, ocspResponse(t, "./testdata/server1.crt", "./testdata/server1.key"))
+
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	c := newClock()
+	cm.SetClock(c.Now)
+	cm.LeveledLogger(levelLogger{buf})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if err := cm.WatchOCSP(ocspFile); err != nil {
+		t.Fatalf("could not watch ocsp file: %v", err)
+	}
+
+	if staple := servedStaple(t, cm); staple == nil {
+		t.Fatal("fresh ocsp response not stapled")
+	}
+
+	c.Advance(2 * time.Hour)
+
+	if staple := servedStaple(t, cm); staple != nil {
+		t.Fatal("expired ocsp response stapled")
+	}
+
+	if status := cm.Status(); status.Stapled {
+		t.Fatalf("status reports expired ocsp response stapled: %+v", status)
+	}
+
+	logWant := "WARN ocsp response expired at "
+	if !strings.Contains(buf.String(), logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", buf.String())
+		t.Fatalf("log from certman not as expected")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package certman_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+)
+
+func TestLoadOCSPServesWhileReading(t *testing.T) {
+	// Reading a FIFO blocks until it is written to, standing in for
+	// slow storage.
+	ocspFile := filepath.Join(t.TempDir(), "server.ocsp")
+	if err := syscall.Mkfifo(ocspFile, 0600); err != nil {
+		t.Skipf("can't create fifo: %v", err)
+	}
+
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	watched := make(chan error, 1)
+	go func() { watched <- cm.WatchOCSP(ocspFile) }()
+	time.Sleep(50 * time.Millisecond)
+
+	served := make(chan struct{})
+	go func() {
+		cm.GetCertificate(&tls.ClientHelloInfo{})
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		os.WriteFile(ocspFile, nil, 0600)
+		<-watched
+		t.Fatal("handshake waited for the ocsp file to be read")
+	}
+
+	good := ocspResponse(t, "./testdata/server1.crt", "./testdata/server1.key")
+	if err := os.WriteFile(ocspFile, good, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-watched; err != nil {
+		t.Fatalf("could not watch ocsp file: %v", err)
+	}
+
+	if staple := servedStaple(t, cm); !bytes.Equal(staple, good) {
+		t.Fatalf("served staple doesn't match ocsp file")
+	}
+}
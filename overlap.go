@@ -0,0 +1,124 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// SetRotationOverlap sets whether a newly loaded certificate that
+// isn't valid yet is held back, with the previously loaded certificate
+// served until the new one's NotBefore is reached. This allows
+// deploying a certificate ahead of time without clients rejecting it
+// as not yet valid. If no certificate was loaded before, the new one
+// is served straight away. The default is false.
+func (cm *CertMan) SetRotationOverlap(overlap bool) {
+	cm.mu.Lock()
+	cm.overlap = overlap
+	cm.mu.Unlock()
+}
+
+// SetSkewBuffer sets how long after a newly loaded certificate's
+// NotBefore to keep serving the previously loaded certificate, so
+// clients with clocks running behind don't reject the new one as not
+// yet valid. The new certificate is held back until then as with
+// SetRotationOverlap, which a non-zero buffer implies. The default is
+// zero.
+func (cm *CertMan) SetSkewBuffer(d time.Duration) {
+	cm.mu.Lock()
+	cm.skew = d
+	cm.mu.Unlock()
+}
+
+// OnActivated registers fn to be called with a certificate held back
+// by SetRotationOverlap or SetSkewBuffer once it becomes valid, plus
+// any skew buffer, and is served. A timer armed to that time serves it
+// then rather than waiting for the next handshake, so certificates can
+// be staged ahead of time and activated on schedule. fn is called
+// without certMan's locks held.
+func (cm *CertMan) OnActivated(fn func(*tls.Certificate)) {
+	cm.mu.Lock()
+	cm.activated = append(cm.activated, fn)
+	cm.mu.Unlock()
+}
+
+// servableFrom returns when keyPair may be served. cm.mu must be held
+// for reading.
+func (cm *CertMan) servableFrom(keyPair *tls.Certificate) time.Time {
+	return keyPair.Leaf.NotBefore.Add(cm.skew)
+}
+
+// hold reports whether keyPair is to be held back until it is valid,
+// plus any skew buffer, rather than served now, and if so makes it the
+// pending certificate. cm.mu must be held for writing.
+func (cm *CertMan) hold(keyPair *tls.Certificate) bool {
+	if cm.activation != nil {
+		cm.activation.Stop()
+		cm.activation = nil
+	}
+
+	if !(cm.overlap || cm.skew > 0) || cm.keyPair == nil || !cm.now().Before(cm.servableFrom(keyPair)) {
+		cm.pending = nil
+		return false
+	}
+
+	cm.pending = keyPair
+	cm.activation = time.AfterFunc(cm.servableFrom(keyPair).Sub(cm.now()), cm.activate)
+
+	return true
+}
+
+// activate promotes the pending certificate when its activation timer
+// fires, re-arming the timer if it isn't due yet by cm's clock.
+func (cm *CertMan) activate() {
+	select {
+	case <-cm.stopping():
+		return
+	default:
+	}
+
+	cm.promote()
+
+	cm.mu.Lock()
+	if cm.pending != nil && cm.activation != nil {
+		cm.activation = time.AfterFunc(cm.servableFrom(cm.pending).Sub(cm.now()), cm.activate)
+	}
+	cm.mu.Unlock()
+}
+
+// promote serves the pending certificate if it has become valid, plus
+// any skew buffer.
+func (cm *CertMan) promote() {
+	if !cm.readLock() {
+		return
+	}
+	due := cm.pending != nil && !cm.now().Before(cm.servableFrom(cm.pending))
+	cm.mu.RUnlock()
+
+	if !due || !cm.writeLock() {
+		return
+	}
+	prev, keyPair := cm.keyPair, cm.pending
+	promoted := keyPair != nil && !cm.now().Before(cm.servableFrom(keyPair))
+	if promoted {
+		cm.setKeyPair(keyPair)
+		cm.pending = nil
+		if cm.activation != nil {
+			cm.activation.Stop()
+			cm.activation = nil
+		}
+	}
+	activated := cm.activated
+	cm.mu.Unlock()
+
+	if promoted {
+		cm.logger().Infof("pending certificate now valid, serving it")
+		cm.logRotation(cm.certName(), prev, keyPair)
+		for _, fn := range activated {
+			fn(keyPair)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+// clock is a manually advanced clock for tests.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Now()}
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestRotationOverlap(t *testing.T) {
+	for _, overlap := range []bool{false, true} {
+		c := newClock()
+
+		certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+		cm, err := certman.New(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.SetClock(c.Now)
+		cm.SetRotationOverlap(overlap)
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+
+		notBefore := c.Now().Add(time.Hour)
+		newCert, newKey := certmantest.GeneratePairValidity(t, notBefore, notBefore.Add(24*time.Hour), "new.example.com")
+		copyFile(newCert, certFile)
+		copyFile(newKey, keyFile)
+		waitReload(t, cm)
+
+		want := "new.example.com"
+		if overlap {
+			want = "old.example.com"
+		}
+		if got := servedName(t, cm, ""); got != want {
+			t.Errorf("overlap %v: serving %q before NotBefore, want %q", overlap, got, want)
+		}
+
+		c.Advance(2 * time.Hour)
+
+		if got := servedName(t, cm, ""); got != "new.example.com" {
+			t.Errorf("overlap %v: serving %q after NotBefore", overlap, got)
+		}
+
+		cm.Stop()
+	}
+}
+
+func TestSkewBuffer(t *testing.T) {
+	c := newClock()
+
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetClock(c.Now)
+	cm.SetSkewBuffer(10 * time.Minute)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	notBefore := c.Now().Add(-time.Minute)
+	newCert, newKey := certmantest.GeneratePairValidity(t, notBefore, notBefore.Add(24*time.Hour), "new.example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Errorf("serving %q within skew buffer, want old.example.com", got)
+	}
+
+	c.Advance(10 * time.Minute)
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Errorf("serving %q after skew buffer, want new.example.com", got)
+	}
+}
+
+func TestOnActivated(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	activated := make(chan string, 1)
+	cm.OnActivated(func(keyPair *tls.Certificate) {
+		activated <- keyPair.Leaf.DNSNames[0]
+	})
+	cm.SetRotationOverlap(true)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	notBefore := time.Now().Add(2 * time.Second)
+	newCert, newKey := certmantest.GeneratePairValidity(t, notBefore, notBefore.Add(24*time.Hour), "new.example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Fatalf("serving %q before NotBefore, want old.example.com", got)
+	}
+
+	select {
+	case name := <-activated:
+		if name != "new.example.com" {
+			t.Fatalf("activated %q, want new.example.com", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pending certificate not activated")
+	}
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after activation, want new.example.com", got)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NewWithPassphraseFile creates a new certMan like New whose key file
+// is encrypted with the passphrase held in passphraseFile, for
+// automated environments storing the passphrase as its own secret. The
+// passphrase file is read on each load, ignoring a trailing newline,
+// and watched alongside the certificate and key files so rotating
+// either the key or the passphrase reloads them. If the key can't be
+// decrypted the load fails and the previous certificate continues to
+// be served. Keys in encrypted PEM blocks (RFC 1423), which crypto/x509
+// deprecates as insecure, are supported; encrypted PKCS#8 keys aren't.
+// Keys of pairs added with AddPair are decrypted with it too.
+func NewWithPassphraseFile(certFile, keyFile, passphraseFile string) (*CertMan, error) {
+	cm, err := New(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if cm.passFile, err = filepath.Abs(passphraseFile); err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+// decryptKey decrypts the encrypted private key blocks in keyPEM with
+// the passphrase from the passphrase file, if one is set.
+func (cm *CertMan) decryptKey(keyPEM []byte) ([]byte, error) {
+	cm.mu.RLock()
+	passFile := cm.passFile
+	cm.mu.RUnlock()
+
+	if passFile == "" {
+		return keyPEM, nil
+	}
+
+	var b bytes.Buffer
+	var passphrase []byte
+	for rest := keyPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("can't decrypt key file: encrypted PKCS#8 keys aren't supported")
+		case x509.IsEncryptedPEMBlock(block):
+			if passphrase == nil {
+				p, err := os.ReadFile(passFile)
+				if err != nil {
+					return nil, errors.Wrap(err, "can't read passphrase file")
+				}
+				passphrase = []byte(strings.TrimRight(string(p), "\r\n"))
+			}
+
+			der, err := x509.DecryptPEMBlock(block, passphrase)
+			if err != nil {
+				return nil, errors.Wrap(err, "can't decrypt key file")
+			}
+			block = &pem.Block{Type: block.Type, Bytes: der}
+		}
+
+		pem.Encode(&b, block)
+	}
+
+	return b.Bytes(), nil
+}
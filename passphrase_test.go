@@ -0,0 +1,92 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestPassphraseFile(t *testing.T) {
+	certFile, plainKey := certmantest.GeneratePair(t, "example.com")
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "tls.key")
+	passFile := filepath.Join(dir, "passphrase")
+
+	encryptKey(t, plainKey, keyFile, "first")
+	writeFile(t, passFile, "first\n")
+
+	cm, err := certman.NewWithPassphraseFile(certFile, keyFile, passFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if status := cm.Status(); !status.Loaded {
+		t.Fatalf("encrypted key not loaded: %v", cm.LastError())
+	}
+
+	// A wrong passphrase keeps the previous certificate.
+	writeFile(t, passFile, "wrong\n")
+	time.Sleep(200 * time.Millisecond)
+
+	if err := cm.LastError(); err == nil || !strings.Contains(err.Error(), "can't decrypt key file") {
+		t.Fatalf("unexpected error after passphrase change: %v", err)
+	}
+	if got := servedName(t, cm, ""); got != "example.com" {
+		t.Fatalf("serving %q after failed decryption, want example.com", got)
+	}
+
+	// Rotating the key and passphrase together reloads.
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	encryptKey(t, newKey, keyFile, "second")
+	writeFile(t, passFile, "second\n")
+	copyFile(newCert, certFile)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after rotation, want new.example.com", got)
+	}
+}
+
+// encryptKey writes the key in plainFile to file encrypted with
+// passphrase.
+func encryptKey(t *testing.T, plainFile, file, passphrase string) {
+	b, err := os.ReadFile(plainFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(b)
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEMFile(t, file, encrypted)
+}
+
+func writeFile(t *testing.T, file, content string) {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package certman
+
+// equalPath reports whether a and b name the same file.
+func equalPath(a, b string) bool {
+	return a == b
+}
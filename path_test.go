@@ -0,0 +1,39 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSameFile(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, file string
+		want       bool
+	}{
+		{"testdata/server.crt", "./testdata/server.crt", true},
+		{"testdata/server.crt", "testdata//server.crt", true},
+		{"testdata/server.crt/", "testdata/server.crt", true},
+		{"testdata/server.crt", "testdata/server.key", false},
+		{"testdata/server.crt", "", false},
+		{filepath.Join(dir, "tls.crt"), filepath.Join(link, "tls.crt"), true},
+		{filepath.Join(dir, "tls.crt"), filepath.Join(link, "tls.key"), false},
+		{filepath.Join(dir, "tls.crt"), filepath.Join(t.TempDir(), "tls.crt"), false},
+	}
+
+	for _, tt := range tests {
+		if got := sameFile(tt.name, tt.file); got != tt.want {
+			t.Errorf("sameFile(%q, %q) = %v, want %v", tt.name, tt.file, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// equalPath reports whether a and b name the same file. On Windows
+// paths are case insensitive and either separator may be used, and
+// fsnotify doesn't necessarily report names the way they were given.
+func equalPath(a, b string) bool {
+	return strings.EqualFold(filepath.FromSlash(a), filepath.FromSlash(b))
+}
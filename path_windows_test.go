@@ -0,0 +1,42 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestSameFileWindows(t *testing.T) {
+	tests := []struct {
+		name, file string
+		want       bool
+	}{
+		{`C:\certs\tls.crt`, `C:\certs\tls.crt`, true},
+		{`C:\certs\tls.crt`, `C:/certs/tls.crt`, true},
+		{`c:\Certs\TLS.crt`, `C:\certs\tls.crt`, true},
+		{`C:\certs\tls.key`, `C:\certs\tls.crt`, false},
+	}
+
+	for _, tt := range tests {
+		if got := sameFile(tt.name, tt.file); got != tt.want {
+			t.Errorf("sameFile(%q, %q) = %v, want %v", tt.name, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestRelevantWindows(t *testing.T) {
+	cm, err := New(`C:\certs\tls.crt`, `C:\certs\tls.key`)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	for _, name := range []string{`C:\certs\TLS.KEY`, `C:/certs/tls.crt`, `C:\certs\..data`} {
+		if !cm.relevant(fsnotify.Event{Name: name}) {
+			t.Errorf("event for %q not relevant", name)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"encoding/pem"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// WritePEM writes the loaded certificate chain to w as PEM encoded
+// CERTIFICATE blocks, leaf first. The private key is never written.
+// It returns an error if no certificate is loaded.
+func (cm *CertMan) WritePEM(w io.Writer) error {
+	cm.mu.RLock()
+	keyPair := cm.keyPair
+	cm.mu.RUnlock()
+
+	if keyPair == nil {
+		return errors.New("no certificate loaded")
+	}
+
+	for _, der := range keyPair.Certificate {
+		if err := pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return errors.Wrap(err, "can't write certificate")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/dyson/certman"
+)
+
+func TestWritePEM(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := cm.WritePEM(&buf); err == nil || err.Error() != "no certificate loaded" {
+		t.Fatalf("unexpected write error before load: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if err := cm.WritePEM(&buf); err != nil {
+		t.Fatalf("could not write pem: %v", err)
+	}
+
+	want, err := os.ReadFile("./testdata/server1.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(buf.Bytes()), bytes.TrimSpace(want)) {
+		t.Log("pem expected:", string(want))
+		t.Log("pem received:", buf.String())
+		t.Fatalf("written pem doesn't match served certificate")
+	}
+	if bytes.Contains(buf.Bytes(), []byte("PRIVATE KEY")) {
+		t.Fatalf("private key written")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// A PermissionCheck controls how the permissions of key files are
+// checked when they are loaded.
+type PermissionCheck int
+
+const (
+	// PermissionCheckOff doesn't check key file permissions.
+	PermissionCheckOff PermissionCheck = iota
+
+	// PermissionCheckWarn logs a warning when a key file is
+	// accessible by its group or others but loads it anyway.
+	PermissionCheckWarn
+
+	// PermissionCheckStrict fails to load a key file accessible by
+	// its group or others, continuing to serve the old certificate.
+	PermissionCheckStrict
+
+	// PermissionCheckRefuse is PermissionCheckStrict, and also makes
+	// Watch return an error rather than start watching if the key
+	// file is accessible by its group or others, so deployments fail
+	// closed.
+	PermissionCheckRefuse
+)
+
+// SetKeyPermissionCheck sets how the permissions of key files are
+// checked on each load. Key files should only be accessible by their
+// owner, so this catches misconfigured secret mounts. The default is
+// PermissionCheckOff. Permissions aren't checked on Windows.
+func (cm *CertMan) SetKeyPermissionCheck(check PermissionCheck) {
+	cm.mu.Lock()
+	cm.permCheck = check
+	cm.mu.Unlock()
+}
+
+// checkKeyPermissions checks the permissions of keyFile according to
+// the key permission check, returning an error if the key shouldn't
+// be loaded.
+func (cm *CertMan) checkKeyPermissions(keyFile string) error {
+	cm.mu.RLock()
+	check := cm.permCheck
+	cm.mu.RUnlock()
+
+	if check == PermissionCheckOff || runtime.GOOS == "windows" {
+		return nil
+	}
+
+	err := keyPermissions(keyFile)
+	if err != nil && check == PermissionCheckWarn {
+		cm.logger().Warnf("%v", err)
+		return nil
+	}
+
+	return err
+}
+
+// refuseKeyPermissions returns an error if the key file shouldn't be
+// watched as it is accessible by its group or others.
+func (cm *CertMan) refuseKeyPermissions() error {
+	cm.mu.RLock()
+	check := cm.permCheck
+	cm.mu.RUnlock()
+
+	if check != PermissionCheckRefuse || cm.keySource != nil || runtime.GOOS == "windows" {
+		return nil
+	}
+
+	_, keyFile := cm.files()
+	if err := keyPermissions(keyFile); err != nil {
+		return errors.Wrap(err, "can't watch key file")
+	}
+
+	return nil
+}
+
+// keyPermissions returns an error if keyFile is accessible by its
+// group or others.
+func keyPermissions(keyFile string) error {
+	fi, err := os.Stat(keyFile)
+	if err != nil {
+		return err
+	}
+
+	if mode := fi.Mode().Perm(); mode&0077 != 0 {
+		return fmt.Errorf("key file %s has permissions %#o, accessible by group or others", keyFile, mode)
+	}
+
+	return nil
+}
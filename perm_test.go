@@ -0,0 +1,106 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestKeyPermissionCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("key permissions aren't checked on windows")
+	}
+
+	tests := []struct {
+		check  certman.PermissionCheck
+		mode   os.FileMode
+		loaded bool
+		log    string
+	}{
+		{certman.PermissionCheckOff, 0644, true, ""},
+		{certman.PermissionCheckWarn, 0600, true, ""},
+		{certman.PermissionCheckWarn, 0644, true, "WARN key file"},
+		{certman.PermissionCheckStrict, 0600, true, ""},
+		{certman.PermissionCheckStrict, 0640, false, "ERROR can't load cert or key file: key file"},
+	}
+
+	for _, tt := range tests {
+		buf := new(syncBuffer)
+
+		certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+		if err := os.Chmod(keyFile, tt.mode); err != nil {
+			t.Fatal(err)
+		}
+
+		cm, err := certman.New(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{buf})
+		cm.SetKeyPermissionCheck(tt.check)
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		cm.Stop()
+
+		if loaded := cm.Status().Loaded; loaded != tt.loaded {
+			t.Errorf("check %v mode %#o: loaded %v, want %v", tt.check, tt.mode, loaded, tt.loaded)
+		}
+
+		logGot := buf.String()
+		if tt.log == "" && strings.Contains(logGot, "key file "+keyFile) ||
+			tt.log != "" && !strings.Contains(logGot, tt.log) {
+			t.Errorf("check %v mode %#o: unexpected log output: %s", tt.check, tt.mode, logGot)
+		}
+	}
+}
+
+func TestKeyPermissionRefuse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("key permissions aren't checked on windows")
+	}
+
+	for _, mode := range []os.FileMode{0600, 0604} {
+		certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+		if err := os.Chmod(keyFile, mode); err != nil {
+			t.Fatal(err)
+		}
+
+		cm, err := certman.New(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{new(syncBuffer)})
+		cm.SetKeyPermissionCheck(certman.PermissionCheckRefuse)
+		err = cm.Watch()
+
+		if mode == 0600 {
+			if err != nil {
+				t.Fatalf("mode %#o: could not watch files: %v", mode, err)
+			}
+			cm.Stop()
+			continue
+		}
+
+		if err == nil {
+			cm.Stop()
+			t.Fatalf("mode %#o: watching key file accessible by others", mode)
+		}
+		if !strings.Contains(err.Error(), "0604") {
+			t.Fatalf("mode %#o: error doesn't include the mode: %v", mode, err)
+		}
+		if cm.Status().Loaded {
+			t.Fatalf("mode %#o: certificate loaded", mode)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetSPKIPins sets the public keys certificates may be loaded for, as
+// base64 encoded SHA-256 hashes of their SubjectPublicKeyInfo, the
+// form used by HPKP, optionally prefixed by "sha256/". A certificate
+// whose public key matches none of the pins fails to load, as any
+// other load error, and the previous certificate continues to be
+// served, so a mis-issued certificate swapped onto disk isn't served.
+// The pins apply to pairs added with AddPair too. Calling it with no
+// pins, the default, loads certificates for any public key.
+func (cm *CertMan) SetSPKIPins(pins ...string) {
+	set := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		set[strings.TrimPrefix(pin, "sha256/")] = true
+	}
+
+	cm.mu.Lock()
+	cm.pins = set
+	cm.mu.Unlock()
+}
+
+// spkiPin returns the pin of the public key of keyPair's leaf.
+func spkiPin(keyPair *tls.Certificate) string {
+	sum := sha256.Sum256(keyPair.Leaf.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// checkPins returns an error if pins are set and the public key of
+// keyPair's leaf doesn't match any of them.
+func (cm *CertMan) checkPins(keyPair *tls.Certificate) error {
+	cm.mu.RLock()
+	pins := cm.pins
+	cm.mu.RUnlock()
+
+	if len(pins) == 0 {
+		return nil
+	}
+
+	if pin := spkiPin(keyPair); !pins[pin] {
+		return errors.Errorf("certificate public key sha256/%s isn't pinned", pin)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestSPKIPins(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	pinnedCert, pinnedKey := certmantest.GeneratePair(t, "pinned.example.com")
+	rogueCert, rogueKey := certmantest.GeneratePair(t, "rogue.example.com")
+	copyFile(pinnedCert, certFile)
+	copyFile(pinnedKey, keyFile)
+
+	sum := sha256.Sum256(leaf(t, pinnedCert).RawSubjectPublicKeyInfo)
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	cm.SetSPKIPins(pin)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if got := servedName(t, cm, ""); got != "pinned.example.com" {
+		t.Fatalf("serving %q, want pinned.example.com", got)
+	}
+
+	copyFile(rogueCert, certFile)
+	copyFile(rogueKey, keyFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if got := servedName(t, cm, ""); got != "pinned.example.com" {
+		t.Fatalf("serving %q after unpinned certificate swapped in", got)
+	}
+	if !strings.Contains(buf.String(), "isn't pinned") {
+		t.Log("log output received:", buf.String())
+		t.Fatalf("unpinned certificate not reported")
+	}
+
+	cm.SetSPKIPins()
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload without pins: %v", err)
+	}
+	if got := servedName(t, cm, ""); got != "rogue.example.com" {
+		t.Fatalf("serving %q after removing pins", got)
+	}
+}
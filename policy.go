@@ -0,0 +1,189 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// policyFile is the JSON representation of a TLS policy file:
+//
+//	{
+//		"min_version": "1.2",
+//		"cipher_suites": ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"],
+//		"curve_preferences": ["X25519", "P256"]
+//	}
+//
+// Cipher suites use the names of the crypto/tls constants. Omitted
+// fields fall back to the crypto/tls defaults.
+type policyFile struct {
+	MinVersion       string   `json:"min_version"`
+	CipherSuites     []string `json:"cipher_suites"`
+	CurvePreferences []string `json:"curve_preferences"`
+}
+
+// policy is a validated policy file.
+type policy struct {
+	minVersion       uint16
+	cipherSuites     []uint16
+	curvePreferences []tls.CurveID
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+	"X25519": tls.X25519,
+}
+
+// WatchPolicy loads the JSON TLS policy in policyFile and watches it
+// for changes alongside the certificate and key files. The policy is
+// applied by the configs returned from GetTLSConfig and
+// GetConfigForClient. If a changed policy can't be read or is invalid
+// the previous policy continues to be used.
+func (cm *CertMan) WatchPolicy(policyFile string) error {
+	policyFile, err := filepath.Abs(policyFile)
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	cm.policyFile = policyFile
+	cm.mu.Unlock()
+
+	if err := cm.loadPolicy(); err != nil {
+		return err
+	}
+
+	if watcher := cm.currentWatcher(); watcher != nil {
+		if err := addWatch(watcher, filepath.Dir(policyFile)); err != nil {
+			return errors.Wrap(err, "can't watch policy file")
+		}
+	}
+
+	return nil
+}
+
+func (cm *CertMan) loadPolicy() error {
+	cm.mu.RLock()
+	policyFile := cm.policyFile
+	cm.mu.RUnlock()
+
+	b, err := os.ReadFile(policyFile)
+	if err != nil {
+		return errors.Wrap(err, "can't read policy file")
+	}
+
+	p, err := parsePolicy(b)
+	if err != nil {
+		return errors.Wrap(err, "can't parse policy file")
+	}
+
+	cm.mu.Lock()
+	cm.policy = p
+	cm.mu.Unlock()
+	cm.logger().Infof("policy loaded")
+
+	return nil
+}
+
+func parsePolicy(b []byte) (*policy, error) {
+	var pf policyFile
+	if err := json.Unmarshal(b, &pf); err != nil {
+		return nil, err
+	}
+
+	p := &policy{}
+
+	if pf.MinVersion != "" {
+		v, ok := tlsVersions[pf.MinVersion]
+		if !ok {
+			return nil, errors.Errorf("unknown min_version %q", pf.MinVersion)
+		}
+		p.minVersion = v
+	}
+
+	suites := map[string]uint16{}
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[s.Name] = s.ID
+	}
+	for _, name := range pf.CipherSuites {
+		id, ok := suites[name]
+		if !ok {
+			return nil, errors.Errorf("unknown cipher suite %q", name)
+		}
+		p.cipherSuites = append(p.cipherSuites, id)
+	}
+
+	for _, name := range pf.CurvePreferences {
+		id, ok := tlsCurves[name]
+		if !ok {
+			return nil, errors.Errorf("unknown curve %q", name)
+		}
+		p.curvePreferences = append(p.curvePreferences, id)
+	}
+
+	return p, nil
+}
+
+// GetTLSConfig returns a tls.Config serving the loaded certificate
+// with the current policy. The config's GetConfigForClient field is
+// set so policy changes apply to new connections without a restart:
+// each connection is served a clone of the returned config, taken when
+// it starts, with the policy applied, so other fields set on the
+// returned config, such as ClientAuth and NextProtos, are kept.
+func (cm *CertMan) GetTLSConfig() *tls.Config {
+	base := cm.config(&tls.Config{})
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return cm.config(base.Clone()), nil
+	}
+
+	return base
+}
+
+// GetConfigForClient returns a tls.Config serving the loaded
+// certificate with the current policy for use by the
+// GetConfigForClient field of a tls.Config. The returned config has
+// only those fields set and replaces the server's config for the
+// connection, so servers setting other fields should use the config
+// returned by GetTLSConfig instead.
+func (cm *CertMan) GetConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	return cm.config(&tls.Config{}), nil
+}
+
+// config sets the certificate, key log writer and policy fields of cfg
+// from certMan and returns it.
+func (cm *CertMan) config(cfg *tls.Config) *tls.Config {
+	cfg.GetCertificate = cm.GetCertificate
+	cfg.GetConfigForClient = nil
+
+	cm.mu.RLock()
+	p, keyLog := cm.policy, cm.keyLog
+	cm.mu.RUnlock()
+
+	if keyLog != nil {
+		cfg.KeyLogWriter = keyLog
+	}
+
+	if p != nil {
+		cfg.MinVersion = p.minVersion
+		cfg.CipherSuites = p.cipherSuites
+		cfg.CurvePreferences = p.curvePreferences
+	}
+
+	return cfg
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestWatchPolicy(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, policyFile, `{
+		"min_version": "1.2",
+		"cipher_suites": ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"],
+		"curve_preferences": ["X25519", "P256"]
+	}`)
+
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	if err := cm.WatchPolicy(policyFile); err != nil {
+		t.Fatalf("could not watch policy file: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	cfg, _ := cm.GetTLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if cfg.MinVersion != tls.VersionTLS12 ||
+		!reflect.DeepEqual(cfg.CipherSuites, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}) ||
+		!reflect.DeepEqual(cfg.CurvePreferences, []tls.CurveID{tls.X25519, tls.CurveP256}) {
+		t.Fatalf("config doesn't match policy: %+v", cfg)
+	}
+
+	writePolicy(t, policyFile, `{"min_version": "1.3"}`)
+	time.Sleep(200 * time.Millisecond)
+
+	cfg, _ = cm.GetConfigForClient(&tls.ClientHelloInfo{})
+	if cfg.MinVersion != tls.VersionTLS13 || cfg.CipherSuites != nil {
+		t.Fatalf("config doesn't match reloaded policy: %+v", cfg)
+	}
+
+	buf.Reset()
+	writePolicy(t, policyFile, `{"min_version": "9.9"}`)
+	time.Sleep(200 * time.Millisecond)
+
+	logWant := `can't load policy file: can't parse policy file: unknown min_version "9.9"`
+	if !strings.Contains(buf.String(), logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", buf.String())
+		t.Fatalf("log from certman not as expected")
+	}
+
+	cfg, _ = cm.GetConfigForClient(&tls.ClientHelloInfo{})
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("invalid policy replaced the previous one: %+v", cfg)
+	}
+}
+
+func TestWatchPolicyInvalid(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, policyFile, `{"cipher_suites": ["TLS_NOT_A_SUITE"]}`)
+
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	err = cm.WatchPolicy(policyFile)
+	if err == nil || !strings.HasPrefix(err.Error(), "can't parse policy file:") {
+		t.Fatalf("unexpected watch policy error: %v", err)
+	}
+}
+
+func TestPolicyKeepsConfigFields(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, policyFile, `{"min_version": "1.2"}`)
+
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.WatchPolicy(policyFile); err != nil {
+		t.Fatalf("could not watch policy file: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	cfg := cm.GetTLSConfig()
+	cfg.ClientAuth = tls.RequireAnyClientCert
+	cfg.NextProtos = []string{"h2"}
+
+	clientCert, clientKey := certmantest.GeneratePair(t, "client.test")
+	clientPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, withCert := range []bool{true, false} {
+		clientCfg := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}}
+		if withCert {
+			clientCfg.Certificates = []tls.Certificate{clientPair}
+		}
+
+		serverConn, clientConn := net.Pipe()
+		serverErr := make(chan error, 1)
+		go func() {
+			defer serverConn.Close()
+			serverErr <- tls.Server(serverConn, cfg).Handshake()
+		}()
+
+		client := tls.Client(clientConn, clientCfg)
+		client.Handshake()
+		proto := client.ConnectionState().NegotiatedProtocol
+		clientConn.Close()
+		err := <-serverErr
+
+		switch {
+		case withCert && err != nil:
+			t.Fatalf("could not handshake: %v", err)
+		case withCert && proto != "h2":
+			t.Fatalf("negotiated protocol %q, want h2", proto)
+		case !withCert && err == nil:
+			t.Fatalf("handshake without a client certificate succeeded")
+		}
+	}
+}
+
+func writePolicy(t *testing.T, policyFile, policy string) {
+	tmp := policyFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, policyFile); err != nil {
+		t.Fatal(err)
+	}
+}
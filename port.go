@@ -0,0 +1,73 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// MapPort serves the certificate at certIndex to clients connecting to
+// the local port, regardless of the server name they request, for a
+// server listening on several ports with different certificates.
+// Indexes are as for MapCIDR, which takes precedence, and likewise
+// follow their pair across manifest reloads. Mapping a port
+// again replaces its mapping. Clients connecting to other ports, or to
+// a port mapped to a pair that isn't loaded, are served by server name
+// as usual.
+func (cm *CertMan) MapPort(port int, certIndex int) error {
+	if port <= 0 || port > 65535 {
+		return errors.Errorf("can't map port: invalid port %d", port)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if certIndex < 0 || certIndex > len(cm.pairs) {
+		return errors.Errorf("can't map port: no certificate at index %d", certIndex)
+	}
+
+	if cm.ports == nil {
+		cm.ports = map[int]*pair{}
+	}
+	cm.ports[port] = cm.pairAt(certIndex)
+	cm.storeSnapshot()
+
+	return nil
+}
+
+// selectByPort returns the loaded certificate mapped to the local port
+// the client sending hello connected to, or nil if there isn't one.
+func (s *serveState) selectByPort(hello *tls.ClientHelloInfo) *tls.Certificate {
+	if len(s.ports) == 0 || hello.Conn == nil {
+		return nil
+	}
+
+	return s.ports[localPort(hello.Conn.LocalAddr())]
+}
+
+// localPort returns the port of addr, or 0 if it doesn't have one.
+func localPort(addr net.Addr) int {
+	switch a := addr.(type) {
+	case nil:
+		return 0
+	case *net.TCPAddr:
+		return a.Port
+	case *net.UDPAddr:
+		return a.Port
+	}
+
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0
+	}
+
+	p, _ := strconv.Atoi(port)
+
+	return p
+}
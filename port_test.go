@@ -0,0 +1,84 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestMapPort(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "example.com")
+	adminCert, adminKey := certmantest.GeneratePair(t, "admin.test")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.AddPair(adminCert, adminKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+	if err := cm.MapPort(8443, 1); err != nil {
+		t.Fatalf("could not map port: %v", err)
+	}
+	if err := cm.MapPort(9443, 0); err != nil {
+		t.Fatalf("could not map port: %v", err)
+	}
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	tests := []struct {
+		port       int
+		serverName string
+		want       string
+	}{
+		{8443, "example.com", "admin.test"},
+		{9443, "admin.test", "example.com"},
+		{443, "example.com", "example.com"},
+		{443, "admin.test", "admin.test"},
+	}
+
+	for _, tt := range tests {
+		cert, err := cm.GetCertificate(&tls.ClientHelloInfo{
+			ServerName: tt.serverName,
+			Conn:       localConn{addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: tt.port}},
+		})
+		if err != nil {
+			t.Fatalf("could not get certman certificate: %v", err)
+		}
+		if got := cert.Leaf.DNSNames[0]; got != tt.want {
+			t.Errorf("port %d served %q, want %q", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestMapPortInvalid(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.MapPort(0, 0); err == nil {
+		t.Fatalf("invalid port mapped")
+	}
+	if err := cm.MapPort(8443, 1); err == nil {
+		t.Fatalf("port mapped to missing pair")
+	}
+}
+
+// localConn is a net.Conn with only a local address.
+type localConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c localConn) LocalAddr() net.Addr { return c.addr }
@@ -0,0 +1,63 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// SetStrictInitialLoad sets whether Watch returns an error, rather than
+// logging it and watching for the files to be fixed, if the certificate
+// and key can't be loaded when it starts. Before loading them it checks
+// both files can be read and hold PEM blocks, once decoded from PKCS#12
+// or DER if they are in either format, so gross misconfiguration
+// such as pointing at the wrong file is reported with the path of the
+// file at fault. The default is false.
+func (cm *CertMan) SetStrictInitialLoad(strict bool) {
+	cm.mu.Lock()
+	cm.strictLoad = strict
+	cm.mu.Unlock()
+}
+
+// preflight returns an error if the certificate or key file can't be
+// read or holds no PEM block once decoded from PKCS#12 or DER as for
+// loading.
+func (cm *CertMan) preflight() error {
+	certFile, keyFile := cm.files()
+
+	certPEM, err := readPEM(nil, certFile)
+	if err != nil {
+		return errors.Wrapf(err, "can't read cert file %s", certFile)
+	}
+
+	if certPEM, err = cm.decodeCerts(certFile, certPEM); err != nil {
+		return errors.Wrapf(err, "cert file %s", certFile)
+	}
+
+	if block, _ := pem.Decode(certPEM); block == nil {
+		return errors.Errorf("cert file %s contains no PEM block", certFile)
+	}
+
+	if cm.keySource != nil {
+		return nil
+	}
+
+	keyPEM, err := readPEM(nil, keyFile)
+	if err != nil {
+		return errors.Wrapf(err, "can't read key file %s", keyFile)
+	}
+
+	if keyPEM, err = cm.decodeKey(keyFile, keyPEM); err != nil {
+		return errors.Wrapf(err, "key file %s", keyFile)
+	}
+
+	if block, _ := pem.Decode(keyPEM); block == nil {
+		return errors.Errorf("key file %s contains no PEM block", keyFile)
+	}
+
+	return nil
+}
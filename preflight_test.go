@@ -0,0 +1,96 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestStrictInitialLoad(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	_, otherKeyFile := certmantest.GeneratePair(t, "other.example.com")
+
+	notPEM := filepath.Join(t.TempDir(), "tls.key")
+	if err := os.WriteFile(notPEM, []byte("not a key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.key")
+
+	tests := []struct {
+		keyFile string
+		err     string
+	}{
+		{keyFile, ""},
+		{notPEM, "key file " + notPEM + " contains no PEM block"},
+		{otherKeyFile, "private key does not match public key"},
+		{missing, "can't watch key file"},
+	}
+
+	for _, tt := range tests {
+		cm, err := certman.New(certFile, tt.keyFile)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{new(syncBuffer)})
+		cm.SetStrictInitialLoad(true)
+		err = cm.Watch()
+
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("key %s: could not watch files: %v", tt.keyFile, err)
+			}
+			cm.Stop()
+			continue
+		}
+
+		if err == nil {
+			cm.Stop()
+			t.Fatalf("key %s: watching despite failed initial load", tt.keyFile)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("key %s: error %q doesn't contain %q", tt.keyFile, err, tt.err)
+		}
+	}
+}
+
+func TestStrictInitialLoadPKCS12(t *testing.T) {
+	for _, password := range []string{"certman", "wrong"} {
+		cm, err := certman.NewPKCS12("./testdata/server1.p12", password)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{new(syncBuffer)})
+		cm.SetStrictInitialLoad(true)
+		err = cm.Watch()
+
+		if password == "wrong" {
+			if err == nil {
+				cm.Stop()
+				t.Fatal("watching PKCS#12 file despite wrong password")
+			}
+			if !strings.Contains(err.Error(), "server1.p12: can't decode cert file") {
+				t.Fatalf("error %q doesn't name the PKCS#12 file", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("could not watch PKCS#12 file: %v", err)
+		}
+		if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+			cm.Stop()
+			t.Fatal("pair in PKCS#12 file not served")
+		}
+		cm.Stop()
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A PairError is the failure to load a certificate and key pair.
+type PairError struct {
+	CertFile string
+	KeyFile  string
+	Err      error
+}
+
+func (e *PairError) Error() string {
+	return fmt.Sprintf("%s, %s: %v", e.CertFile, e.KeyFile, e.Err)
+}
+
+func (e *PairError) Unwrap() error {
+	return e.Err
+}
+
+// PairErrors lists the pairs that failed to load, one per line.
+type PairErrors []*PairError
+
+func (e PairErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Preload loads the pair passed to New and every pair added with
+// AddPair once, without watching them, and returns PairErrors listing
+// those that failed, or nil if all loaded. This allows checking a
+// configuration of many pairs, for example in CI before deploying.
+// Loaded pairs are served as if loaded by Watch.
+func (cm *CertMan) Preload() error {
+	var errs PairErrors
+
+	if err := cm.reload(); err != nil {
+		certFile, keyFile := cm.files()
+		if cm.source != nil {
+			certFile, keyFile = sourceName, sourceName
+		}
+		errs = append(errs, &PairError{certFile, keyFile, err})
+	}
+
+	cm.mu.RLock()
+	pairs := append([]*pair(nil), cm.pairs...)
+	cm.mu.RUnlock()
+
+	for _, p := range pairs {
+		if err := cm.loadPair(p); err != nil {
+			errs = append(errs, &PairError{p.certFile, p.keyFile, err})
+		}
+	}
+
+	cm.mu.Lock()
+	cm.indexNames()
+	cm.mu.Unlock()
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestPreload(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "default.example.com")
+	aCert, aKey := certmantest.GeneratePair(t, "a.example.com")
+	bCert, _ := certmantest.GeneratePair(t, "b.example.com")
+	_, otherKey := certmantest.GeneratePair(t, "other.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.AddPair(aCert, aKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+
+	if err := cm.Preload(); err != nil {
+		t.Fatalf("could not preload valid pairs: %v", err)
+	}
+
+	if got := servedName(t, cm, "a.example.com"); got != "a.example.com" {
+		t.Fatalf("serving %q after preload, want a.example.com", got)
+	}
+
+	if err := cm.AddPair(bCert, otherKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+
+	err = cm.Preload()
+	errs, ok := err.(certman.PairErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("unexpected preload error: %v", err)
+	}
+	if errs[0].CertFile != bCert || errs[0].KeyFile != otherKey {
+		t.Fatalf("preload error for %s, %s, want %s, %s", errs[0].CertFile, errs[0].KeyFile, bCert, otherKey)
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "crypto/tls"
+
+// A CertificateProvider provides server certificates for the
+// GetCertificate field of a tls.Config. *CertMan implements it.
+type CertificateProvider interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// A ClientCertificateProvider provides client certificates for the
+// GetClientCertificate field of a tls.Config. *CertMan implements it.
+type ClientCertificateProvider interface {
+	GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+}
+
+var (
+	_ CertificateProvider       = (*CertMan)(nil)
+	_ ClientCertificateProvider = (*CertMan)(nil)
+)
@@ -0,0 +1,41 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/dyson/certman"
+)
+
+func TestCertificateProvider(t *testing.T) {
+	cm, err := certman.New("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	var p certman.CertificateProvider = cm
+	var c certman.ClientCertificateProvider = cm
+
+	server, err := p.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("could not get certificate: %v", err)
+	}
+
+	client, err := c.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("could not get client certificate: %v", err)
+	}
+
+	if server != client {
+		t.Fatalf("providers returned different certificates")
+	}
+}
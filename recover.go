@@ -0,0 +1,231 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// defaultRewatchDelay is how long to wait between attempts to
+// re-establish the watch after it is lost.
+const defaultRewatchDelay = time.Second
+
+// SetWatchRetry sets Watch to retry every interval, rather than fail,
+// while the certificate and key files or their directories can't be
+// watched for lack of permission, for when permissions are fixed after
+// startup such as by a sidecar. Watch blocks while retrying and gives
+// up with an error once deadline has passed since it was called. An
+// interval of zero, the default, doesn't retry.
+func (cm *CertMan) SetWatchRetry(interval, deadline time.Duration) {
+	cm.mu.Lock()
+	cm.permRetry = interval
+	cm.permDeadline = deadline
+	cm.mu.Unlock()
+}
+
+// OnWatchRecovered registers fn to be called each time the watch is
+// re-established after an error from the watcher or the removal of a
+// watched directory. Until then the watch is retried and the previous
+// certificate continues to be used. The certificate and key are
+// reloaded before fn is called as changes may have been missed while
+// they weren't watched. fn is called from the watching goroutine.
+func (cm *CertMan) OnWatchRecovered(fn func()) {
+	cm.mu.Lock()
+	cm.recovered = append(cm.recovered, fn)
+	cm.mu.Unlock()
+}
+
+// OnFileRemoved registers fn to be called with the path of a watched
+// file each time it is removed, separately from any reload, as early
+// warning of a rotation going wrong or an accidental deletion. Files
+// replaced by a rename aren't removed so don't call fn. fn is called
+// from the watching goroutine without certMan's locks held.
+func (cm *CertMan) OnFileRemoved(fn func(path string)) {
+	cm.mu.Lock()
+	cm.removed = append(cm.removed, fn)
+	cm.mu.Unlock()
+}
+
+// removedFile returns the watched file removed by event, or "" if event
+// isn't the removal of a watched file.
+func (cm *CertMan) removedFile(event fsnotify.Event) string {
+	if event.Op&fsnotify.Remove == 0 {
+		return ""
+	}
+
+	certFile, keyFile := cm.files()
+	files := []string{certFile, keyFile}
+	for _, w := range cm.watchedFiles() {
+		files = append(files, w.file)
+	}
+
+	for _, f := range files {
+		if sameFile(event.Name, f) {
+			return f
+		}
+	}
+
+	return ""
+}
+
+// fileRemoved calls the callbacks registered with OnFileRemoved.
+func (cm *CertMan) fileRemoved(path string) {
+	cm.mu.RLock()
+	removed := cm.removed
+	cm.mu.RUnlock()
+
+	for _, fn := range removed {
+		fn(path)
+	}
+}
+
+// watchedDirRemoved reports whether event is the removal of a
+// directory being watched, after which it no longer is.
+func (cm *CertMan) watchedDirRemoved(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) == 0 {
+		return false
+	}
+
+	return cm.watchedDir(event.Name)
+}
+
+// watchedDirUnmounted reports whether event is the filesystem mounted
+// on a directory being watched being unmounted, after which it no
+// longer is. fsnotify passes on inotify's unmount event with no op.
+func (cm *CertMan) watchedDirUnmounted(event fsnotify.Event) bool {
+	return event.Op == 0 && cm.watchedDir(event.Name)
+}
+
+// remounted returns an error unless the certificate and key files are
+// present again after their directory was unmounted, so the watch
+// isn't re-established on the bare mount point before the remount.
+func (cm *CertMan) remounted() error {
+	certFile, keyFile := cm.files()
+
+	for _, f := range []string{certFile, keyFile} {
+		if _, err := os.Stat(f); err != nil {
+			return errors.Wrap(err, "waiting for remount")
+		}
+	}
+
+	return nil
+}
+
+// watchedDir reports whether name is a directory being watched.
+func (cm *CertMan) watchedDir(name string) bool {
+	certFile, keyFile := cm.files()
+	dirs := []string{filepath.Dir(certFile), filepath.Dir(keyFile)}
+	for _, w := range cm.watchedFiles() {
+		dirs = append(dirs, filepath.Dir(w.file))
+	}
+
+	cm.mu.RLock()
+	if cm.interDir != "" {
+		dirs = append(dirs, cm.interDir)
+	}
+	cm.mu.RUnlock()
+
+	for _, dir := range dirs {
+		if equalPath(filepath.Clean(name), dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errNotWatching is returned by Restart when certMan isn't watching.
+var errNotWatching = errors.New("can't restart: not watching")
+
+// Restart replaces the watcher with a new one watching the same files,
+// for recovering from a wedged watcher without stopping. The loaded
+// certificates continue to be served throughout, events already seen
+// are still reloaded and the files are reloaded once the new watcher
+// is in place so changes made during the restart aren't lost. If the
+// new watcher can't be created, or the files can't be loaded through
+// it, the old one continues to be used and the error is returned.
+func (cm *CertMan) Restart() error {
+	cm.mu.RLock()
+	watching, done := cm.watcher != nil, cm.done
+	cm.mu.RUnlock()
+
+	if !watching {
+		return errNotWatching
+	}
+
+	reply := make(chan error, 1)
+	select {
+	case cm.restart <- reply:
+	case <-done:
+		return errNotWatching
+	}
+
+	return <-reply
+}
+
+// replaceWatcher replaces old with a new watcher watching the same
+// directories and reloads, as changes may have been missed while the
+// watchers were swapped. It's used once old has stopped working, so
+// the new watcher is kept even if the files can't be loaded, which is
+// recorded as any failed load.
+func (cm *CertMan) replaceWatcher(old *fsnotify.Watcher) (*fsnotify.Watcher, error) {
+	watcher, err := cm.newWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	cm.mu.Lock()
+	cm.watcher = watcher
+	cm.mu.Unlock()
+
+	old.Close()
+
+	cm.reload()
+	cm.loadPairs(nil)
+
+	return watcher, nil
+}
+
+// restartWatcher replaces old with a new watcher watching the same
+// directories once the files have been loaded through it. If they
+// can't be loaded the new watcher is closed, old is kept and the error
+// is returned.
+func (cm *CertMan) restartWatcher(old *fsnotify.Watcher) (*fsnotify.Watcher, error) {
+	watcher, err := cm.newWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cm.reload(); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	cm.mu.Lock()
+	cm.watcher = watcher
+	cm.mu.Unlock()
+
+	old.Close()
+
+	cm.loadPairs(nil)
+
+	return watcher, nil
+}
+
+// watchRecovered calls the callbacks registered with OnWatchRecovered.
+func (cm *CertMan) watchRecovered() {
+	cm.mu.RLock()
+	recovered := cm.recovered
+	cm.mu.RUnlock()
+
+	for _, fn := range recovered {
+		fn()
+	}
+}
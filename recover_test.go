@@ -0,0 +1,274 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestOnWatchRecovered(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := filepath.Join(t.TempDir(), "certs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	recovered := make(chan struct{}, 1)
+	cm.LeveledLogger(levelLogger{buf})
+	cm.SetRewatchDelay(50 * time.Millisecond)
+	cm.OnWatchRecovered(func() { recovered <- struct{}{} })
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile("./testdata/server2.crt", crt)
+	copyFile("./testdata/server2.key", key)
+
+	select {
+	case <-recovered:
+	case <-time.After(time.Second):
+		t.Log("log output received:", buf.String())
+		t.Fatalf("watch not recovered")
+	}
+
+	for _, line := range []string{"WARN watched directory", "ERROR can't re-establish watch", "INFO watch re-established"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("log from certman doesn't contain %q", line)
+		}
+	}
+
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("pair changed while unwatched not loaded on recovery")
+	}
+
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+	waitReload(t, cm)
+
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("pair not reloaded after recovery")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Restart(); err == nil {
+		t.Fatalf("restarted before watching")
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	// A change seen just before the restart is still loaded.
+	copyPair(dir, "./testdata/server2.crt", "./testdata/server2.key")
+	if err := cm.Restart(); err != nil {
+		t.Fatalf("could not restart: %v", err)
+	}
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("change before restart not loaded")
+	}
+	if !strings.Contains(buf.String(), "INFO watch restarted") {
+		t.Log("log output received:", buf.String())
+		t.Fatalf("restart not logged")
+	}
+
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+	waitReload(t, cm)
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("change after restart not loaded")
+	}
+
+	cm.Stop()
+	<-cm.Done()
+
+	if err := cm.Restart(); err == nil {
+		t.Fatalf("restarted after stopping")
+	}
+}
+
+func TestOnFileRemoved(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	removed := make(chan string, 2)
+	cm.OnFileRemoved(func(path string) { removed <- path })
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// Replacing the file by a rename isn't a removal.
+	newCert, _ := certmantest.GeneratePair(t, "example.com")
+	copyFile(newCert, certFile)
+
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case path := <-removed:
+		if path != keyFile {
+			t.Fatalf("removal of %s reported, want %s", path, keyFile)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("removal not reported")
+	}
+
+	if !cm.Status().Loaded {
+		t.Fatalf("certificate no longer served after removal")
+	}
+}
+
+func TestWatchRetry(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	dir := filepath.Dir(certFile)
+	if err := os.Chmod(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0700)
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetWatchRetry(10*time.Millisecond, 50*time.Millisecond)
+	if err := cm.Watch(); err == nil || !strings.Contains(err.Error(), "gave up watching after 50ms") {
+		t.Fatalf("unexpected watch error: %v", err)
+	}
+
+	cm.SetWatchRetry(10*time.Millisecond, 5*time.Second)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.Chmod(dir, 0700)
+	}()
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files once permitted: %v", err)
+	}
+	defer cm.Stop()
+
+	if !cm.Status().Loaded {
+		t.Fatalf("certificate not loaded")
+	}
+}
+
+func TestRemount(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := filepath.Join(t.TempDir(), "certs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	recovered := make(chan struct{}, 1)
+	cm.LeveledLogger(levelLogger{buf})
+	cm.SetRewatchDelay(50 * time.Millisecond)
+	cm.OnWatchRecovered(func() { recovered <- struct{}{} })
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// Unmounting leaves the bare mount point, without the files, and
+	// inotify drops the watch on it after an unmount event.
+	if err := os.Remove(crt); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(key); err != nil {
+		t.Fatal(err)
+	}
+	cm.InjectEvent(fsnotify.Event{Name: dir})
+	time.Sleep(200 * time.Millisecond)
+
+	select {
+	case <-recovered:
+		t.Fatalf("watch re-established before remount")
+	default:
+	}
+
+	copyFile("./testdata/server2.crt", crt)
+	copyFile("./testdata/server2.key", key)
+
+	select {
+	case <-recovered:
+	case <-time.After(time.Second):
+		t.Log("log output received:", buf.String())
+		t.Fatalf("watch not recovered after remount")
+	}
+
+	for _, line := range []string{"WARN watched directory " + dir + " unmounted", "INFO watch re-established after remount"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("log from certman doesn't contain %q", line)
+		}
+	}
+
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("remounted pair not loaded on recovery")
+	}
+
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+	waitReload(t, cm)
+
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("pair not reloaded after remount")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SetRecursiveWatch sets how many levels of subdirectories below the
+// directories of the certificate and key files are also watched. Any
+// change within them reloads the pair, which suits secret projections
+// that nest the real files several symlinks deep. The files are opened
+// by their original paths on each load so symlinks are resolved
+// afresh. Subdirectories created later are watched if within depth.
+// The depth bounds how much of a large tree is watched. The default of
+// zero watches only the directories themselves. It must be called
+// before Watch.
+func (cm *CertMan) SetRecursiveWatch(depth int) {
+	cm.mu.Lock()
+	cm.depth = depth
+	cm.mu.Unlock()
+}
+
+// treeRoots returns the directories watched recursively.
+func (cm *CertMan) treeRoots() []string {
+	certFile, keyFile := cm.files()
+
+	roots := []string{filepath.Dir(certFile)}
+	if keyDir := filepath.Dir(keyFile); keyDir != roots[0] {
+		roots = append(roots, keyDir)
+	}
+
+	return roots
+}
+
+// watchTrees adds to watcher the subdirectories of the recursively
+// watched directories up to the recursive watch depth.
+func (cm *CertMan) watchTrees(watcher *fsnotify.Watcher) error {
+	cm.mu.RLock()
+	depth := cm.depth
+	cm.mu.RUnlock()
+
+	if depth <= 0 {
+		return nil
+	}
+
+	for _, root := range cm.treeRoots() {
+		if err := cm.watchTree(watcher, root, root, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// watchTree adds dir and its subdirectories to watcher, where dir is
+// within the tree at root, while they are less than depth levels below
+// root.
+func (cm *CertMan) watchTree(watcher *fsnotify.Watcher, root, dir string, depth int) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		level := treeLevel(root, path)
+		if level > depth {
+			return filepath.SkipDir
+		}
+		if level > 0 {
+			return addWatch(watcher, path)
+		}
+
+		return nil
+	})
+}
+
+// treeLevel returns how many levels below root path is, or -1 if it
+// isn't within root.
+func treeLevel(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return -1
+	}
+
+	if rel == "." {
+		return 0
+	}
+
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// treeEvent reports whether event concerns a file within a recursively
+// watched tree, watching the directory it names if one was created.
+func (cm *CertMan) treeEvent(event fsnotify.Event) bool {
+	cm.mu.RLock()
+	depth := cm.depth
+	cm.mu.RUnlock()
+
+	if depth <= 0 {
+		return false
+	}
+
+	for _, root := range cm.treeRoots() {
+		level := treeLevel(root, event.Name)
+		if level < 1 || level > depth+1 {
+			continue
+		}
+
+		if event.Op&fsnotify.Create != 0 && level <= depth {
+			if fi, err := os.Lstat(event.Name); err == nil && fi.IsDir() {
+				if err := cm.watchTree(cm.currentWatcher(), root, event.Name, depth); err != nil {
+					cm.logger().Errorf("can't watch directory %s: %v", event.Name, err)
+				}
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+)
+
+func TestRecursiveWatch(t *testing.T) {
+	for _, depth := range []int{0, 1} {
+		dir := t.TempDir()
+		projectPair(t, dir, "..data", "..v1", "./testdata/server1.crt", "./testdata/server1.key")
+
+		cm, err := certman.New(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		// Without the marker only the recursive watch can see the
+		// files change inside the versioned directory.
+		cm.SetProjectionMarker("")
+		cm.SetRecursiveWatch(depth)
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+
+		copyFile("./testdata/server2.crt", filepath.Join(dir, "..v1", "tls.crt"))
+		copyFile("./testdata/server2.key", filepath.Join(dir, "..v1", "tls.key"))
+		time.Sleep(200 * time.Millisecond)
+		cm.Stop()
+
+		want := "./testdata/server1"
+		if depth > 0 {
+			want = "./testdata/server2"
+		}
+		if !servedCert(t, cm, want+".crt", want+".key") {
+			t.Errorf("depth %d: served certificate is not %s.crt", depth, want)
+		}
+	}
+}
+
+func TestRecursiveWatchNewDirectory(t *testing.T) {
+	dir := t.TempDir()
+	projectPair(t, dir, "..data", "..v1", "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetProjectionMarker("")
+	cm.SetRecursiveWatch(1)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// Swap to a new versioned directory, then update the files in it.
+	projectPair(t, dir, "..data", "..v2", "./testdata/server1.crt", "./testdata/server1.key")
+	waitReload(t, cm)
+
+	copyFile("./testdata/server2.crt", filepath.Join(dir, "..v2", "tls.crt"))
+	copyFile("./testdata/server2.key", filepath.Join(dir, "..v2", "tls.key"))
+	waitReload(t, cm)
+
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("change in new directory not reloaded")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"sort"
+	"sync"
+)
+
+// registry holds the certMans registered by name with Register.
+var registry = struct {
+	sync.RWMutex
+	byName map[string]*CertMan
+}{byName: map[string]*CertMan{}}
+
+// Register adds cm to the package's registry under name, replacing any
+// certMan already registered under it, so processes with several can
+// manage them together, for example from an admin endpoint, with Get,
+// ReloadAll and StopAll. Registering is optional and certMans that
+// aren't registered are unaffected. Registering a nil cm removes name.
+func Register(name string, cm *CertMan) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if cm == nil {
+		delete(registry.byName, name)
+		return
+	}
+
+	registry.byName[name] = cm
+}
+
+// Get returns the certMan registered under name, and whether there is
+// one.
+func Get(name string) (*CertMan, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	cm, ok := registry.byName[name]
+
+	return cm, ok
+}
+
+// ReloadAll reloads each registered certMan as by Reload, in order of
+// name, returning the errors of those failing keyed by name, or nil if
+// none did.
+func ReloadAll() map[string]error {
+	var errs map[string]error
+
+	for _, r := range registered() {
+		if _, err := r.cm.Reload(); err != nil {
+			if errs == nil {
+				errs = map[string]error{}
+			}
+			errs[r.name] = err
+		}
+	}
+
+	return errs
+}
+
+// StopAll stops each registered certMan, as by Stop, in order of
+// name, returning straight away for those not watching. They remain
+// registered.
+func StopAll() {
+	for _, r := range registered() {
+		r.cm.Stop()
+	}
+}
+
+// A namedCertMan is a registered certMan and its name.
+type namedCertMan struct {
+	name string
+	cm   *CertMan
+}
+
+// registered returns the registered certMans in order of name, so
+// they can be used without holding the registry's lock.
+func registered() []namedCertMan {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	all := make([]namedCertMan, 0, len(registry.byName))
+	for name, cm := range registry.byName {
+		all = append(all, namedCertMan{name, cm})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+	return all
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestRegistry(t *testing.T) {
+	goodCert, goodKey := certmantest.GeneratePair(t, "good.test")
+	badCert, _ := certmantest.GeneratePair(t, "bad.test")
+
+	good, err := certman.New(goodCert, goodKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+	bad, err := certman.New(badCert, goodKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	certman.Register("good", good)
+	certman.Register("bad", bad)
+	defer certman.Register("good", nil)
+	defer certman.Register("bad", nil)
+
+	if cm, ok := certman.Get("good"); !ok || cm != good {
+		t.Fatalf("registered certman not returned")
+	}
+	if _, ok := certman.Get("missing"); ok {
+		t.Fatalf("unregistered name found")
+	}
+
+	errs := certman.ReloadAll()
+	if len(errs) != 1 || errs["bad"] == nil {
+		t.Fatalf("want a reload error for bad only, got %v", errs)
+	}
+
+	if err := good.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	certman.StopAll()
+
+	select {
+	case <-good.Done():
+	case <-time.After(time.Second):
+		t.Fatal("watching certman not stopped")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		certman.StopAll()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stopping stopped certmans blocked")
+	}
+
+	certman.Register("bad", nil)
+	if _, ok := certman.Get("bad"); ok {
+		t.Fatalf("certman registered as nil not removed")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// Reload loads the certificate and key files now, as happens when a
+// change to them is seen, along with any pairs added with AddPair. It
+// reports whether the certificate served by default changed. If the
+// load fails the old certificate continues to be served and the error
+// is returned.
+func (cm *CertMan) Reload() (bool, error) {
+	before := cm.leafDER()
+	err := cm.reload()
+	cm.loadPairs(nil)
+
+	return !bytes.Equal(before, cm.leafDER()), err
+}
+
+// leafDER returns the DER encoding of the leaf of the certificate
+// served by default, or nil if none is loaded.
+func (cm *CertMan) leafDER() []byte {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.keyPair == nil {
+		return nil
+	}
+
+	return cm.keyPair.Certificate[0]
+}
+
+// reloadResponse is the JSON body written by the ReloadHandler.
+type reloadResponse struct {
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReloadHandler returns a handler calling Reload on POST requests and
+// responding with JSON reporting whether the served certificate
+// changed and any error, for example:
+//
+//	{"changed":true}
+//
+// Failed reloads respond with status 500. The handler does no
+// authentication and should be mounted behind admin authentication.
+func (cm *CertMan) ReloadHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		changed, err := cm.Reload()
+
+		resp := reloadResponse{Changed: changed}
+		status := http.StatusOK
+		if err != nil {
+			resp.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestReload(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if changed, err := cm.Reload(); !changed || err != nil {
+		t.Fatalf("first reload returned %v, %v", changed, err)
+	}
+
+	if changed, err := cm.Reload(); changed || err != nil {
+		t.Fatalf("unchanged reload returned %v, %v", changed, err)
+	}
+
+	newCert, newKey := certmantest.GeneratePair(t, "example.com")
+	copyFile(newCert, certFile)
+
+	if changed, err := cm.Reload(); changed || err == nil {
+		t.Fatalf("mismatched reload returned %v, %v", changed, err)
+	}
+
+	copyFile(newKey, keyFile)
+
+	if changed, err := cm.Reload(); !changed || err != nil {
+		t.Fatalf("changed reload returned %v, %v", changed, err)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	tests := []struct {
+		method  string
+		keyFile string
+		status  int
+		body    string
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+		{http.MethodPost, "", http.StatusOK, `{"changed":true}` + "\n"},
+		{http.MethodPost, "", http.StatusOK, `{"changed":false}` + "\n"},
+		{http.MethodPost, "./testdata/server1.key", http.StatusInternalServerError,
+			`{"changed":false,"error":"tls: private key type does not match public key type"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		if tt.keyFile != "" {
+			copyFile(tt.keyFile, keyFile)
+		}
+
+		rec := httptest.NewRecorder()
+		cm.ReloadHandler()(rec, httptest.NewRequest(tt.method, "/reload", strings.NewReader("")))
+
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.method, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestReloadQueue(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	var loads atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	cm.SetValidator(func(*tls.Certificate) error {
+		if loads.Add(1) == 1 {
+			close(entered)
+			<-release
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	reload := func() {
+		defer wg.Done()
+		if _, err := cm.Reload(); err != nil {
+			t.Errorf("could not reload: %v", err)
+		}
+	}
+
+	wg.Add(1)
+	go reload()
+	<-entered
+
+	// Reloads requested while one is in progress share a single
+	// queued reload.
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go reload()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("%d loads for overlapping reloads, want 2", n)
+	}
+}
+
+func TestReloadStorm(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetCoalesceWindow(0)
+	cm.SetSettleDelay(0)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				cm.Reload()
+			}
+		}()
+	}
+
+	var last string
+	for i := 0; i < 10; i++ {
+		last = fmt.Sprintf("host%d.example.com", i)
+		newCert, newKey := certmantest.GeneratePair(t, last)
+		copyFile(newCert, certFile)
+		copyFile(newKey, keyFile)
+	}
+	wg.Wait()
+	time.Sleep(200 * time.Millisecond)
+
+	if got := servedName(t, cm, ""); got != last {
+		t.Fatalf("serving %q after event storm, want %q", got, last)
+	}
+}
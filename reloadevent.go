@@ -0,0 +1,78 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// A ReloadEvent describes a successful load of the certificate and
+// key, for the callbacks registered with OnReload.
+type ReloadEvent struct {
+	// File is the file whose watch event triggered the load, or empty
+	// if it wasn't triggered by one, such as a call to Reload. When
+	// several events are coalesced into one load it is the last.
+	File string
+
+	// Op is the operation of the triggering watch event, or zero.
+	Op fsnotify.Op
+
+	// Changed reports whether the leaf certificate differs from the
+	// one served before the load, so callbacks can ignore reloads of
+	// unchanged files.
+	Changed bool
+
+	// Fingerprint is the SHA-256 fingerprint of the served leaf
+	// certificate.
+	Fingerprint [32]byte
+
+	// Certificate is the served certificate, which must not be
+	// modified.
+	Certificate *tls.Certificate
+}
+
+// OnReload registers fn to be called after each successful load of the
+// certificate and key, with the context of the load. fn is called from
+// the goroutine that loaded the files, without certMan's locks held, so
+// it may call Reload or Stop.
+func (cm *CertMan) OnReload(fn func(ReloadEvent)) {
+	cm.mu.Lock()
+	cm.onReload = append(cm.onReload, fn)
+	cm.mu.Unlock()
+}
+
+// fingerprint returns the fingerprint of the served leaf certificate,
+// or the zero value if there isn't one.
+func (cm *CertMan) fingerprint() [32]byte {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.info.Fingerprint
+}
+
+// reloadNotifier collects the event for the callbacks registered with
+// OnReload after a load triggered by trigger, prev being the fingerprint
+// of the leaf served before it, and returns a func that calls them.
+func (cm *CertMan) reloadNotifier(trigger fsnotify.Event, prev [32]byte) func() {
+	cm.mu.RLock()
+	e := ReloadEvent{
+		File:        trigger.Name,
+		Op:          trigger.Op,
+		Fingerprint: cm.info.Fingerprint,
+		Certificate: cm.keyPair,
+	}
+	fns := cm.onReload
+	cm.mu.RUnlock()
+
+	e.Changed = e.Fingerprint != prev
+
+	return func() {
+		for _, fn := range fns {
+			fn(e)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestOnReload(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	events := make(chan certman.ReloadEvent, 8)
+	cm.OnReload(func(e certman.ReloadEvent) { events <- e })
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if e := nextReload(t, events); !e.Changed || e.File != "" {
+		t.Fatalf("unexpected event for first load: %+v", e)
+	}
+
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload: %v", err)
+	}
+	if e := nextReload(t, events); e.Changed || e.File != "" || e.Op != 0 {
+		t.Fatalf("unexpected event for reload of unchanged files: %+v", e)
+	}
+
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	copyFile(newKey, keyFile)
+	copyFile(newCert, certFile)
+
+	e := nextReload(t, events)
+	if !e.Changed || e.File != certFile || e.Op == 0 {
+		t.Fatalf("unexpected event for rotation: %+v", e)
+	}
+	if e.Fingerprint != sha256.Sum256(leaf(t, newCert).Raw) || e.Certificate.Leaf.DNSNames[0] != "new.example.com" {
+		t.Fatalf("event doesn't describe the rotated certificate: %+v", e)
+	}
+}
+
+func TestOnReloadCallsReload(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	var reloaded bool
+	done := make(chan error, 1)
+	cm.OnReload(func(certman.ReloadEvent) {
+		if reloaded {
+			return
+		}
+		reloaded = true
+		_, err := cm.Reload()
+		done <- err
+	})
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("could not reload from callback: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload from callback didn't return")
+	}
+
+	stopped := make(chan struct{})
+	cm.OnReload(func(certman.ReloadEvent) {
+		cm.Stop()
+		close(stopped)
+	})
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload: %v", err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop from callback didn't return")
+	}
+}
+
+func nextReload(t *testing.T, events <-chan certman.ReloadEvent) certman.ReloadEvent {
+	t.Helper()
+
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("reload not reported")
+	}
+
+	return certman.ReloadEvent{}
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ReplacePair replaces the certificate and key files passed to New
+// with certFile and keyFile, for migrations moving the files and
+// changing their content at once. The new files are loaded before
+// anything is changed, then the watches are moved to their
+// directories, if watching, and the new certificate is served, or held
+// back as set by SetRotationOverlap. The new files must pass the same
+// checks as any load, such as SetSPKIPins. If they can't be loaded or
+// watched the old files continue to be watched and served and the
+// error is returned.
+func (cm *CertMan) ReplacePair(certFile, keyFile string) error {
+	if cm.source != nil || cm.fsys != nil {
+		return errors.New("can't replace pair: not loading from files")
+	}
+
+	certAbs, err := filepath.Abs(certFile)
+	if err != nil {
+		return err
+	}
+
+	keyAbs, err := filepath.Abs(keyFile)
+	if err != nil {
+		return err
+	}
+
+	loadFile, loadKey := certAbs, keyAbs
+
+	cm.mu.Lock()
+	relative := cm.relative
+	oldCertFile, oldKeyFile := cm.certFile, cm.keyFile
+	oldCertPath, oldKeyPath := cm.certPath, cm.keyPath
+	cm.mu.Unlock()
+
+	if relative {
+		loadFile, loadKey = certFile, keyFile
+	}
+
+	if err := cm.checkKeyPermissions(loadKey); err != nil {
+		return errors.Wrap(err, "can't replace pair")
+	}
+
+	keyPair, err := cm.loadKeyPair(loadFile, loadKey)
+	if err != nil {
+		return errors.Wrap(err, "can't replace pair")
+	}
+
+	cm.mu.RLock()
+	old := cm.keyPair
+	cm.mu.RUnlock()
+
+	if err := cm.checkLoaded(old, keyPair); err != nil {
+		return errors.Wrap(err, "can't replace pair")
+	}
+
+	cm.mu.Lock()
+	cm.certFile, cm.keyFile = certAbs, keyAbs
+	cm.certPath, cm.keyPath = certFile, keyFile
+	cm.mu.Unlock()
+
+	err = cm.Restart()
+	if err == errNotWatching {
+		err = cm.reload()
+	}
+
+	if err != nil {
+		cm.mu.Lock()
+		cm.certFile, cm.keyFile = oldCertFile, oldKeyFile
+		cm.certPath, cm.keyPath = oldCertPath, oldKeyPath
+		cm.mu.Unlock()
+
+		return errors.Wrap(err, "can't replace pair")
+	}
+
+	cm.logger().Infof("replaced pair with %s and %s", certFile, keyFile)
+
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestReplacePair(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// A pair that can't be loaded leaves the old files served and
+	// watched.
+	badCert, _ := certmantest.GeneratePair(t, "bad.example.com")
+	_, otherKey := certmantest.GeneratePair(t, "other.example.com")
+	if err := cm.ReplacePair(badCert, otherKey); err == nil {
+		t.Fatalf("replaced with a mismatched pair")
+	}
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Fatalf("serving %q after failed replace, want old.example.com", got)
+	}
+
+	if err := cm.ReplacePair(filepath.Join(t.TempDir(), "missing.crt"), keyFile); err == nil {
+		t.Fatalf("replaced with a missing file")
+	}
+
+	renewedCert, renewedKey := certmantest.GeneratePair(t, "renewed.example.com")
+	copyFile(renewedCert, certFile)
+	copyFile(renewedKey, keyFile)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "renewed.example.com" {
+		t.Fatalf("serving %q after change to old files, want renewed.example.com", got)
+	}
+
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	if err := cm.ReplacePair(newCert, newKey); err != nil {
+		t.Fatalf("could not replace pair: %v", err)
+	}
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after replace, want new.example.com", got)
+	}
+
+	laterCert, laterKey := certmantest.GeneratePair(t, "later.example.com")
+	copyFile(laterCert, newCert)
+	copyFile(laterKey, newKey)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "later.example.com" {
+		t.Fatalf("serving %q after change to new files, want later.example.com", got)
+	}
+}
+
+func TestReplacePairPinned(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	sum := sha256.Sum256(leaf(t, certFile).RawSubjectPublicKeyInfo)
+	cm.SetSPKIPins(base64.StdEncoding.EncodeToString(sum[:]))
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	if err := cm.ReplacePair(newCert, newKey); err == nil {
+		t.Fatalf("replaced with an unpinned pair")
+	}
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Fatalf("serving %q after failed replace, want old.example.com", got)
+	}
+	if _, ok := cm.HandshakeCounts()[certFile]; !ok {
+		t.Fatalf("handshake counts moved to the new files after failed replace")
+	}
+
+	// A restart that can't load the files keeps the old watcher, which
+	// still loads later changes.
+	dir := t.TempDir()
+	origCert, origKey := filepath.Join(dir, "orig.crt"), filepath.Join(dir, "orig.key")
+	copyFile(certFile, origCert)
+	copyFile(keyFile, origKey)
+
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+	if err := cm.Restart(); err == nil {
+		t.Fatalf("restarted loading an unpinned pair")
+	}
+
+	copyFile(origCert, certFile)
+	copyFile(origKey, keyFile)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Fatalf("serving %q after failed restart, want old.example.com", got)
+	}
+}
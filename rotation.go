@@ -0,0 +1,98 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+)
+
+// A RotationCheck controls how reloads renewing a certificate without
+// rotating its key are handled.
+type RotationCheck int
+
+const (
+	// RotationCheckOff doesn't check that keys are rotated.
+	RotationCheckOff RotationCheck = iota
+
+	// RotationCheckWarn logs a warning when a reloaded certificate
+	// differs from the one served but has the same public key, and
+	// loads it anyway.
+	RotationCheckWarn
+
+	// RotationCheckStrict fails to load a certificate that differs
+	// from the one served but has the same public key, continuing to
+	// serve the old certificate.
+	RotationCheckStrict
+)
+
+// SetKeyRotationCheck sets how reloads are checked for a key being
+// rotated along with its certificate, for compliance regimes requiring
+// a new key on each renewal. Warnings and errors include the
+// fingerprints of both certificates and of the reused public key.
+// Reloading the same certificate isn't a renewal so isn't checked. The
+// default is RotationCheckOff.
+func (cm *CertMan) SetKeyRotationCheck(check RotationCheck) {
+	cm.mu.Lock()
+	cm.rotation = check
+	cm.mu.Unlock()
+}
+
+// checkKeyRotation checks that keyPair rotated the key of old, the
+// certificate it replaces, according to the key rotation check,
+// returning an error if keyPair shouldn't be loaded. old may be nil.
+func (cm *CertMan) checkKeyRotation(old, keyPair *tls.Certificate) error {
+	cm.mu.RLock()
+	check := cm.rotation
+	cm.mu.RUnlock()
+
+	if check == RotationCheckOff || old == nil || old.Leaf == nil {
+		return nil
+	}
+
+	if bytes.Equal(old.Certificate[0], keyPair.Certificate[0]) ||
+		!bytes.Equal(old.Leaf.RawSubjectPublicKeyInfo, keyPair.Leaf.RawSubjectPublicKeyInfo) {
+		return nil
+	}
+
+	err := fmt.Errorf("certificate %x renewed as %x without rotating key %x",
+		sha256.Sum256(old.Certificate[0]), sha256.Sum256(keyPair.Certificate[0]),
+		sha256.Sum256(keyPair.Leaf.RawSubjectPublicKeyInfo))
+	if check == RotationCheckWarn {
+		cm.logger().Warnf("%v", err)
+		return nil
+	}
+
+	return err
+}
+
+// SetRotationLogging sets whether each change of a served certificate
+// is logged on a single line giving the fingerprints and NotAfter of
+// the old and new certificates, so the rotation timeline can be
+// reconstructed by searching the logs. The default is false.
+func (cm *CertMan) SetRotationLogging(enabled bool) {
+	cm.mu.Lock()
+	cm.logRotations = enabled
+	cm.mu.Unlock()
+}
+
+// logRotation logs the rotation of the certificate named name from old
+// to keyPair if rotation logging is enabled. The first load, when old
+// is nil, and reloads of the same certificate aren't rotations.
+func (cm *CertMan) logRotation(name string, old, keyPair *tls.Certificate) {
+	cm.mu.RLock()
+	enabled := cm.logRotations
+	cm.mu.RUnlock()
+
+	if !enabled || old == nil || old.Leaf == nil || bytes.Equal(old.Certificate[0], keyPair.Certificate[0]) {
+		return
+	}
+
+	cm.logger().Infof("certificate %s rotated from %x (not after %v) to %x (not after %v)",
+		name, sha256.Sum256(old.Certificate[0]), old.Leaf.NotAfter,
+		sha256.Sum256(keyPair.Certificate[0]), keyPair.Leaf.NotAfter)
+}
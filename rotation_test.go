@@ -0,0 +1,176 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestKeyRotationCheck(t *testing.T) {
+	for _, check := range []certman.RotationCheck{certman.RotationCheckWarn, certman.RotationCheckStrict} {
+		buf := new(syncBuffer)
+
+		dir := t.TempDir()
+		crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+		copyFile("./testdata/server1.crt", crt)
+		copyFile("./testdata/server1.key", key)
+
+		cm, err := certman.New(crt, key)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{buf})
+		cm.SetKeyRotationCheck(check)
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		defer cm.Stop()
+
+		// Reloading the same certificate isn't a renewal.
+		if _, err := cm.Reload(); err != nil {
+			t.Fatalf("unexpected reload error: %v", err)
+		}
+
+		renewed := renew(t, "./testdata/server1.crt", "./testdata/server1.key")
+		writePEMFile(t, crt, &pem.Block{Type: "CERTIFICATE", Bytes: renewed})
+		time.Sleep(200 * time.Millisecond)
+
+		served, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("could not get certman certificate: %v", err)
+		}
+
+		switch check {
+		case certman.RotationCheckWarn:
+			if !strings.Contains(buf.String(), "WARN certificate") || !strings.Contains(buf.String(), "without rotating key") {
+				t.Log("log output received:", buf.String())
+				t.Fatalf("renewal without rotating key not warned")
+			}
+			if string(served.Certificate[0]) != string(renewed) {
+				t.Fatalf("renewed certificate not loaded after warning")
+			}
+		case certman.RotationCheckStrict:
+			if !strings.Contains(buf.String(), "ERROR can't load cert or key file: certificate") {
+				t.Log("log output received:", buf.String())
+				t.Fatalf("renewal without rotating key not rejected")
+			}
+			if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+				t.Fatalf("renewal without rotating key replaced the previous certificate")
+			}
+		}
+
+		// A renewal with a new key passes.
+		buf.Reset()
+		copyFile("./testdata/server2.crt", crt)
+		copyFile("./testdata/server2.key", key)
+		waitReload(t, cm)
+
+		if strings.Contains(buf.String(), "without rotating key") {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("renewal rotating key flagged")
+		}
+		if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+			t.Fatalf("renewal rotating key not loaded")
+		}
+	}
+}
+
+func TestRotationLogging(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	cm.SetRotationLogging(true)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if strings.Contains(buf.String(), "rotated") {
+		t.Fatalf("first load logged as rotation: %q", buf.String())
+	}
+
+	old := leaf(t, certFile)
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+	waitReload(t, cm)
+
+	renewed := leaf(t, newCert)
+	logWant := fmt.Sprintf("certificate %s rotated from %x (not after %v) to %x (not after %v)\n",
+		certFile, sha256.Sum256(old.Raw), old.NotAfter, sha256.Sum256(renewed.Raw), renewed.NotAfter)
+	if logGot := buf.String(); !strings.Contains(logGot, logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", logGot)
+		t.Fatalf("rotation not logged")
+	}
+}
+
+// leaf returns the first certificate in the PEM encoded crt.
+func leaf(t *testing.T, crt string) *x509.Certificate {
+	b, err := os.ReadFile(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		t.Fatalf("no certificate in %s", crt)
+	}
+
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// renew returns a new self-signed certificate with the subject, names
+// and key of the certificate in crt.
+func renew(t *testing.T, crt, key string) []byte {
+	keyPair, err := tls.LoadX509KeyPair(crt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf.SerialNumber = new(big.Int).Add(leaf.SerialNumber, big.NewInt(1))
+	signer := keyPair.PrivateKey.(crypto.Signer)
+	der, err := x509.CreateCertificate(rand.Reader, leaf, leaf, signer.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
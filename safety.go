@@ -0,0 +1,62 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// SetSafetyInterval sets the watching goroutine to also check the
+// certificate and key files, and those of pairs added with AddPair,
+// every d and reload them if their contents have changed, in case a
+// change was missed by the watcher. Unchanged files aren't reloaded.
+// An interval of zero, the default, relies on the watcher alone. It
+// takes effect the next time Watch is called.
+func (cm *CertMan) SetSafetyInterval(d time.Duration) {
+	cm.mu.Lock()
+	cm.safety = d
+	cm.mu.Unlock()
+}
+
+// safetyTicker returns a ticker for the safety reload, or nil if it is
+// disabled.
+func (cm *CertMan) safetyTicker() *time.Ticker {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.safety <= 0 {
+		return nil
+	}
+
+	return time.NewTicker(cm.safety)
+}
+
+// filesHash returns a hash of the contents of the certificate and key
+// files and those of the pairs. Files that can't be read are hashed as
+// empty.
+func (cm *CertMan) filesHash() [sha256.Size]byte {
+	certFile, keyFile := cm.files()
+	files := []string{certFile, keyFile}
+
+	cm.mu.RLock()
+	for _, p := range cm.pairs {
+		files = append(files, p.certFile, p.keyFile)
+	}
+	cm.mu.RUnlock()
+
+	h := sha256.New()
+	for _, f := range files {
+		b, _ := os.ReadFile(f)
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+
+	return sum
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+)
+
+func TestSafetyInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, 100 * time.Millisecond} {
+		buf := new(syncBuffer)
+
+		// The files are symlinks to another directory, so changes to
+		// their targets aren't seen by the watch on their directory.
+		dir, target := t.TempDir(), t.TempDir()
+		crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+		copyFile("./testdata/server1.crt", filepath.Join(target, "tls.crt"))
+		copyFile("./testdata/server1.key", filepath.Join(target, "tls.key"))
+		if err := os.Symlink(filepath.Join(target, "tls.crt"), crt); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(target, "tls.key"), key); err != nil {
+			t.Fatal(err)
+		}
+
+		cm, err := certman.New(crt, key)
+		if err != nil {
+			t.Fatalf("could not create certman: %v", err)
+		}
+
+		cm.LeveledLogger(levelLogger{buf})
+		cm.SetSafetyInterval(interval)
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		if strings.Contains(buf.String(), "without a watch event") {
+			t.Fatalf("interval %v: unchanged files reloaded", interval)
+		}
+
+		copyFile("./testdata/server2.crt", filepath.Join(target, "tls.crt"))
+		copyFile("./testdata/server2.key", filepath.Join(target, "tls.key"))
+		time.Sleep(300 * time.Millisecond)
+
+		reloaded := servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key")
+		cm.Stop()
+
+		if want := interval > 0; reloaded != want {
+			t.Log("log output received:", buf.String())
+			t.Fatalf("interval %v: reloaded %v, want %v", interval, reloaded, want)
+		}
+	}
+}
+
+func TestSafetyIntervalRetriesFailedLoad(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	cm.SetSafetyInterval(200 * time.Millisecond)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	copyFile("./testdata/server2.key", key)
+	copyFile("./testdata/server1.crt", crt)
+
+	for i := 0; cm.LastError() == nil; i++ {
+		if i == 50 {
+			t.Fatalf("mismatched pair not loaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	if !strings.Contains(buf.String(), "INFO files changed without a watch event, reloading") {
+		t.Log("log output received:", buf.String())
+		t.Fatalf("failed load not retried by the safety check")
+	}
+}
+
+func TestSafetyIntervalRetriesFailedSafetyLoad(t *testing.T) {
+	// The files are symlinks to another directory, so changes to their
+	// targets are only seen by the safety check.
+	dir, target := t.TempDir(), t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", filepath.Join(target, "tls.crt"))
+	copyFile("./testdata/server1.key", filepath.Join(target, "tls.key"))
+	if err := os.Symlink(filepath.Join(target, "tls.crt"), crt); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(target, "tls.key"), key); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	var reject atomic.Bool
+	cm.SetValidator(func(*tls.Certificate) error {
+		if reject.Load() {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	cm.SetSafetyInterval(100 * time.Millisecond)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	reject.Store(true)
+	copyFile("./testdata/server2.crt", filepath.Join(target, "tls.crt"))
+	copyFile("./testdata/server2.key", filepath.Join(target, "tls.key"))
+
+	for i := 0; cm.LastError() == nil; i++ {
+		if i == 50 {
+			t.Fatalf("changed files not loaded by the safety check")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	reject.Store(false)
+	time.Sleep(300 * time.Millisecond)
+
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("failed safety check load not retried")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "crypto/tls"
+
+// SetSelector sets a function choosing the certificate each handshake
+// is served in place of the selection by server name, for routing
+// certMan can't anticipate. fn is passed the loaded certificates, the
+// pair passed to New first followed by those added with AddPair in
+// order, and its error is returned by GetCertificate. If it returns
+// neither a certificate nor an error the pair passed to New is served.
+// Mappings by MapCIDR and MapPort still take precedence. fn is called
+// without certMan's lock held, and the certificates must not be
+// modified. A nil fn, the default, restores the selection by server
+// name.
+func (cm *CertMan) SetSelector(fn func(hello *tls.ClientHelloInfo, certs []*tls.Certificate) (*tls.Certificate, error)) {
+	cm.mu.Lock()
+	cm.selector = fn
+	cm.storeSnapshot()
+	cm.mu.Unlock()
+}
+
+// selectCustom returns the certificate chosen by the function set by
+// SetSelector.
+func (s *serveState) selectCustom(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := make([]*tls.Certificate, 0, len(s.pairs)+1)
+	if s.keyPair != nil {
+		certs = append(certs, s.keyPair)
+	}
+	for _, keyPair := range s.pairs {
+		if keyPair != nil {
+			certs = append(certs, keyPair)
+		}
+	}
+
+	keyPair, err := s.selector(hello, certs)
+	if err != nil {
+		return nil, err
+	}
+	if keyPair == nil {
+		keyPair = s.keyPair
+	}
+
+	return keyPair, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestSetSelector(t *testing.T) {
+	defaultCert, defaultKey := certmantest.GeneratePair(t, "default.test")
+	pairCert, pairKey := certmantest.GeneratePair(t, "pair.test")
+
+	cm, err := certman.New(defaultCert, defaultKey)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.AddPair(pairCert, pairKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load pairs: %v", err)
+	}
+
+	errRefused := errors.New("refused")
+	cm.SetSelector(func(hello *tls.ClientHelloInfo, certs []*tls.Certificate) (*tls.Certificate, error) {
+		switch hello.ServerName {
+		case "refused.test":
+			return nil, errRefused
+		case "none.test":
+			return nil, nil
+		}
+		if len(certs) != 2 {
+			t.Errorf("selector passed %d certificates, want 2", len(certs))
+		}
+		return certs[len(certs)-1], nil
+	})
+
+	if got := servedName(t, cm, "default.test"); got != "pair.test" {
+		t.Fatalf("serving %q, want the selected pair.test", got)
+	}
+	if got := servedName(t, cm, "none.test"); got != "default.test" {
+		t.Fatalf("serving %q when nothing selected, want default.test", got)
+	}
+	if _, err := cm.GetCertificate(&tls.ClientHelloInfo{ServerName: "refused.test"}); !errors.Is(err, errRefused) {
+		t.Fatalf("selector error not returned: %v", err)
+	}
+
+	cm.SetSelector(nil)
+
+	if got := servedName(t, cm, "default.test"); got != "default.test" {
+		t.Fatalf("serving %q after selector removed, want default.test", got)
+	}
+}
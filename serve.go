@@ -0,0 +1,150 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+)
+
+// A serveState is a snapshot of what GetCertificate selects the
+// certificate to serve from. It is rebuilt, never modified, when any of
+// it changes, so it can be read without cm.mu held.
+type serveState struct {
+	keyPair  *tls.Certificate
+	pairs    []*tls.Certificate
+	index    *nameIndex
+	counters map[*tls.Certificate]*atomic.Uint64
+	routes   []servedRoute
+	ports    map[int]*tls.Certificate
+	selector func(*tls.ClientHelloInfo, []*tls.Certificate) (*tls.Certificate, error)
+	alpn     []string
+	chains   []versionChain
+	gated    bool
+}
+
+// SetNonBlockingServe sets whether GetCertificate avoids waiting while
+// a reload swaps in a new certificate. Loads are parsed without
+// certMan's lock held, but swapping the result in, along with
+// rebuilding the index of pairs, holds it briefly, stalling handshakes
+// arriving meanwhile. When set, those handshakes are instead served as
+// they would have been before the swap, selecting among the
+// certificates loaded before it. Switching to the maintenance
+// certificate, promoting a pending certificate and dropping a stale
+// OCSP response are left to a later handshake rather than waited for.
+// The default is false.
+func (cm *CertMan) SetNonBlockingServe(nonBlocking bool) {
+	cm.nonBlocking.Store(nonBlocking)
+}
+
+// serving returns the snapshot to serve hello from, waiting for a swap
+// in progress unless non-blocking serving is set.
+func (cm *CertMan) serving() *serveState {
+	if !cm.readLock() {
+		return cm.loadSnapshot()
+	}
+	defer cm.mu.RUnlock()
+
+	return cm.loadSnapshot()
+}
+
+// loadSnapshot returns the snapshot stored by storeSnapshot, or an
+// empty one if there isn't one yet.
+func (cm *CertMan) loadSnapshot() *serveState {
+	if s := cm.snapshot.Load(); s != nil {
+		return s
+	}
+
+	return &serveState{}
+}
+
+// readLock takes cm.mu for reading on behalf of a handshake, returning
+// false without it if non-blocking serving is set and it is held for
+// writing.
+func (cm *CertMan) readLock() bool {
+	if cm.nonBlocking.Load() {
+		return cm.mu.TryRLock()
+	}
+
+	cm.mu.RLock()
+	return true
+}
+
+// writeLock takes cm.mu for writing on behalf of a handshake, returning
+// false without it if non-blocking serving is set and it is held.
+func (cm *CertMan) writeLock() bool {
+	if cm.nonBlocking.Load() {
+		return cm.mu.TryLock()
+	}
+
+	cm.mu.Lock()
+	return true
+}
+
+// storeSnapshot rebuilds the snapshot handshakes are served from. It
+// must be called after changing any of the state it copies. cm.mu must
+// be held for writing.
+func (cm *CertMan) storeSnapshot() {
+	s := &serveState{
+		keyPair:  cm.keyPair,
+		pairs:    make([]*tls.Certificate, len(cm.pairs)),
+		index:    cm.index,
+		counters: cm.counters,
+		routes:   make([]servedRoute, len(cm.routes)),
+		selector: cm.selector,
+		alpn:     cm.alpn,
+		chains:   make([]versionChain, len(cm.chains)),
+		gated:    cm.gated && !cm.validated,
+	}
+
+	for i, p := range cm.pairs {
+		s.pairs[i] = p.keyPair
+	}
+	for i, c := range cm.chains {
+		s.chains[i] = *c
+	}
+	for i, r := range cm.routes {
+		s.routes[i] = servedRoute{network: r.network, keyPair: cm.mapped(r.pair)}
+	}
+	if len(cm.ports) > 0 {
+		s.ports = make(map[int]*tls.Certificate, len(cm.ports))
+		for port, p := range cm.ports {
+			s.ports[port] = cm.mapped(p)
+		}
+	}
+
+	cm.snapshot.Store(s)
+}
+
+// serve returns the certificate to serve the client sending hello.
+func (s *serveState) serve(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := s.checkALPN(hello); err != nil {
+		return nil, err
+	}
+
+	keyPair := s.selectByAddr(hello)
+	if keyPair == nil {
+		keyPair = s.selectByPort(hello)
+	}
+	switch {
+	case keyPair != nil:
+	case s.selector != nil:
+		var err error
+		if keyPair, err = s.selectCustom(hello); err != nil {
+			return nil, err
+		}
+	case len(s.pairs) == 0 || hello.ServerName == "":
+		keyPair = s.keyPair
+	default:
+		keyPair = s.selectCertificate(hello)
+	}
+
+	keyPair, err := s.servable(keyPair)
+	if keyPair != nil {
+		s.countHandshake(keyPair)
+	}
+
+	return s.chainFor(keyPair, hello), err
+}
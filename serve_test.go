@@ -0,0 +1,164 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+// reloading returns a certMan serving a generated pair, with 100 pairs
+// added to make swaps slower, which is reloaded continuously until
+// the returned function is called.
+func reloading(tb testing.TB, nonBlocking bool) (*certman.CertMan, func()) {
+	certFile, keyFile := certmantest.GeneratePair(tb, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		tb.Fatalf("could not create certman: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		crt, key := certmantest.GeneratePair(tb, fmt.Sprintf("host%d.example.com", i))
+		if err := cm.AddPair(crt, key); err != nil {
+			tb.Fatalf("could not add pair: %v", err)
+		}
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	cm.SetNonBlockingServe(nonBlocking)
+	if err := cm.Watch(); err != nil {
+		tb.Fatalf("could not watch files: %v", err)
+	}
+
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				cm.Reload()
+			}
+		}
+	}()
+
+	return cm, func() {
+		close(quit)
+		wg.Wait()
+		cm.Stop()
+	}
+}
+
+func TestNonBlockingServe(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	otherCert, otherKey := certmantest.GeneratePair(t, "other.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+	if err := cm.AddPair(otherCert, otherKey); err != nil {
+		t.Fatalf("could not add pair: %v", err)
+	}
+	cm.RestrictALPN("h2")
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	get := func(hello *tls.ClientHelloInfo) (cert *tls.Certificate, err error) {
+		t.Helper()
+
+		done := make(chan struct{})
+		go func() {
+			cert, err = cm.GetCertificate(hello)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("GetCertificate waited for the lock")
+		}
+		return cert, err
+	}
+
+	cm.SetNonBlockingServe(true)
+	release := cm.HoldLock()
+	defer func() { release() }()
+
+	cert, err := get(&tls.ClientHelloInfo{ServerName: "other.example.com", SupportedProtos: []string{"h2"}})
+	if err != nil || cert == nil || cert.Leaf.DNSNames[0] != "other.example.com" {
+		t.Fatalf("not served the pair selected by server name while locked: %v", err)
+	}
+	if _, err := get(&tls.ClientHelloInfo{SupportedProtos: []string{"http/1.1"}}); err == nil {
+		t.Fatal("served a client outside the ALPN restriction while locked")
+	}
+
+	release()
+	cm.SetNonBlockingServe(false)
+	release = cm.HoldLock()
+
+	done := make(chan struct{})
+	go func() {
+		cm.GetCertificate(&tls.ClientHelloInfo{SupportedProtos: []string{"h2"}})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("GetCertificate didn't wait for the lock with non-blocking serving unset")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	release = func() {}
+	<-done
+}
+
+func TestServeDuringReloads(t *testing.T) {
+	for _, nonBlocking := range []bool{false, true} {
+		cm, stop := reloading(t, nonBlocking)
+
+		for i := 0; i < 10000; i++ {
+			cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+			if err != nil || cert == nil {
+				stop()
+				t.Fatalf("non-blocking %v: could not get certificate during reloads: %v", nonBlocking, err)
+			}
+		}
+
+		stop()
+	}
+}
+
+func BenchmarkGetCertificateDuringReload(b *testing.B) {
+	for _, nonBlocking := range []bool{false, true} {
+		b.Run(fmt.Sprintf("nonblocking=%v", nonBlocking), func(b *testing.B) {
+			cm, stop := reloading(b, nonBlocking)
+			defer stop()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := cm.GetCertificate(&tls.ClientHelloInfo{}); err != nil {
+						b.Errorf("could not get certificate: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Event types written to the event sink.
+const (
+	sinkLoaded       = "loaded"
+	sinkLoadFailed   = "load_failed"
+	sinkWatchEvent   = "watch_event"
+	sinkWatchError   = "watch_error"
+	sinkWatchStarted = "watch_started"
+	sinkWatchStopped = "watch_stopped"
+)
+
+// A sinkRecord is a line written to the event sink.
+type sinkRecord struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	Path        string    `json:"path,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// SetEventSink sets a writer for certMan to write a JSON record to for
+// each load, failed load and watch event, separately from the logger,
+// for pipelines ingesting JSON logs. Each record is a single line
+// holding the time, the event type (loaded, load_failed, watch_event,
+// watch_error, watch_started or watch_stopped), and where they apply
+// the path of the file concerned, the hex encoded SHA-256 fingerprint
+// of the loaded leaf certificate and the error. A certificate held
+// back by SetRotationOverlap or SetSkewBuffer is recorded as loaded
+// with its own fingerprint, though the previous one is still served.
+// Records are written one at a time. It is safe to call while
+// watching.
+func (cm *CertMan) SetEventSink(w io.Writer) {
+	cm.mu.Lock()
+	cm.sink = w
+	cm.mu.Unlock()
+}
+
+// sinkEvents maps the event sink's event types to those sent to the
+// channels returned by Events.
+var sinkEvents = map[string]EventType{
+	sinkLoaded:       EventLoaded,
+	sinkLoadFailed:   EventLoadFailed,
+	sinkWatchStarted: EventWatchStarted,
+	sinkWatchStopped: EventWatchStopped,
+}
+
+// loadedDER returns the leaf certificate last loaded, which is the
+// pending one if it's being held back rather than served.
+func (cm *CertMan) loadedDER() []byte {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.pending != nil {
+		return cm.pending.Certificate[0]
+	}
+	if cm.keyPair == nil {
+		return nil
+	}
+
+	return cm.keyPair.Certificate[0]
+}
+
+// emit writes a record to the event sink, if one is set, and sends the
+// corresponding Event, if there is one. err may be nil. It must not be
+// called with cm.mu held.
+func (cm *CertMan) emit(event, path string, der []byte, err error) {
+	cm.mu.RLock()
+	sink, now := cm.sink, cm.now()
+	cm.mu.RUnlock()
+
+	var sum [sha256.Size]byte
+	if der != nil {
+		sum = sha256.Sum256(der)
+	}
+
+	if t, ok := sinkEvents[event]; ok {
+		cm.publish(Event{Type: t, Path: path, Fingerprint: sum, Err: err})
+	}
+
+	if sink == nil {
+		return
+	}
+
+	r := sinkRecord{Time: now, Event: event, Path: path}
+	if der != nil {
+		r.Fingerprint = hex.EncodeToString(sum[:])
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	cm.sinkMu.Lock()
+	sink.Write(append(b, '\n'))
+	cm.sinkMu.Unlock()
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestEventSink(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetEventSink(buf)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
+	time.Sleep(200 * time.Millisecond)
+	cm.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	keyPair, err := tls.LoadX509KeyPair("./testdata/server1.crt", "./testdata/server1.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(keyPair.Certificate[0])
+	fingerprint := hex.EncodeToString(sum[:])
+
+	type record struct {
+		Time        time.Time
+		Event       string
+		Path        string
+		Fingerprint string
+		Error       string
+	}
+
+	var events []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("record %q isn't json: %v", line, err)
+		}
+		if r.Time.IsZero() {
+			t.Fatalf("record %q has no time", line)
+		}
+
+		switch r.Event {
+		case "loaded":
+			if r.Fingerprint != fingerprint || !strings.HasSuffix(r.Path, "server.crt") {
+				t.Fatalf("unexpected loaded record: %s", line)
+			}
+		case "load_failed":
+			if !strings.Contains(r.Error, "private key does not match public key") {
+				t.Fatalf("unexpected load_failed record: %s", line)
+			}
+		case "watch_event":
+			if r.Path == "" {
+				t.Fatalf("unexpected watch_event record: %s", line)
+			}
+		}
+
+		if len(events) == 0 || events[len(events)-1] != r.Event {
+			events = append(events, r.Event)
+		}
+	}
+
+	want := "loaded watch_started watch_event load_failed watch_stopped"
+	if got := strings.Join(events, " "); got != want {
+		t.Fatalf("events %q, want %q", got, want)
+	}
+}
+
+func TestEventSinkHeldCertificate(t *testing.T) {
+	buf := new(syncBuffer)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.SetRotationOverlap(true)
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load pair: %v", err)
+	}
+
+	notBefore := time.Now().Add(time.Hour)
+	newCert, newKey := certmantest.GeneratePairValidity(t, notBefore, notBefore.Add(24*time.Hour), "new.example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+
+	cm.SetEventSink(buf)
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not load pair: %v", err)
+	}
+
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Fatalf("serving %q, want the previous certificate", got)
+	}
+
+	var r struct{ Event, Fingerprint string }
+	if err := json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &r); err != nil {
+		t.Fatalf("record %q isn't json: %v", buf.String(), err)
+	}
+	sum := sha256.Sum256(leaf(t, newCert).Raw)
+	if r.Event != "loaded" || r.Fingerprint != hex.EncodeToString(sum[:]) {
+		t.Fatalf("loaded record %q doesn't have the held certificate's fingerprint", buf.String())
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// Snapshot returns a copy of the certificate served by default, or the
+// zero tls.Certificate if none is loaded. Unlike GetCertificate, which
+// returns the certificate certMan serves for crypto/tls to use as read
+// only, nothing in the copy is shared with certMan other than the
+// private key, so callers may modify it without affecting handshakes or
+// racing with reloads.
+func (cm *CertMan) Snapshot() tls.Certificate {
+	cm.mu.RLock()
+	keyPair := cm.keyPair
+	cm.mu.RUnlock()
+
+	if keyPair == nil {
+		return tls.Certificate{}
+	}
+
+	c := *keyPair
+	c.Certificate = copyBytes(keyPair.Certificate)
+	c.OCSPStaple = append([]byte(nil), keyPair.OCSPStaple...)
+	c.SignedCertificateTimestamps = copyBytes(keyPair.SignedCertificateTimestamps)
+	c.SupportedSignatureAlgorithms = append([]tls.SignatureScheme(nil), keyPair.SupportedSignatureAlgorithms...)
+	if keyPair.Leaf != nil {
+		c.Leaf, _ = x509.ParseCertificate(c.Certificate[0])
+	}
+
+	return c
+}
+
+// copyBytes returns a deep copy of b.
+func copyBytes(b [][]byte) [][]byte {
+	if b == nil {
+		return nil
+	}
+
+	c := make([][]byte, len(b))
+	for i := range b {
+		c[i] = append([]byte(nil), b[i]...)
+	}
+
+	return c
+}
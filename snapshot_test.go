@@ -0,0 +1,46 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestSnapshot(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if snap := cm.Snapshot(); snap.Certificate != nil {
+		t.Fatalf("snapshot before loading has a certificate")
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	snap := cm.Snapshot()
+	if snap.Leaf == nil || snap.PrivateKey == nil {
+		t.Fatalf("snapshot missing leaf or key")
+	}
+
+	snap.Certificate[0][0] ^= 0xff
+	snap.Leaf.DNSNames[0] = "mutated.example.com"
+
+	if !servedCert(t, cm, certFile, keyFile) {
+		t.Fatalf("modifying snapshot changed the served certificate")
+	}
+	if got := servedName(t, cm, ""); got != "example.com" {
+		t.Fatalf("modifying snapshot changed the served leaf to %q", got)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// socketWriteTimeout bounds how long a connection to the socket
+// listened on by ListenSocket may block writing a line.
+const socketWriteTimeout = time.Second
+
+// ListenSocket listens on a Unix domain socket at path so other
+// processes can observe and trigger reloads without linking against
+// certman. A line is written to each connection for every load:
+//
+//	loaded <cert file> <fingerprint>
+//	load_failed <cert file> <error>
+//
+// where fingerprint is the hex encoded SHA-256 fingerprint of the leaf
+// certificate. Connections may send the line "reload" to call Reload.
+// The socket is closed and removed when Stop is called and listened on
+// again when Watch is next called. It does no authentication so path
+// should only be accessible to trusted users.
+func (cm *CertMan) ListenSocket(path string) error {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return errors.Wrap(err, "can't listen on socket")
+	}
+
+	first := make(chan net.Listener, 1)
+	first <- l
+
+	cm.goSession(func(quit <-chan struct{}) {
+		events, cancel := cm.Events()
+		defer cancel()
+
+		var l net.Listener
+		select {
+		case l = <-first:
+		default:
+			var err error
+			if l, err = net.Listen("unix", path); err != nil {
+				cm.logger().Errorf("can't listen on socket: %v", err)
+				return
+			}
+		}
+
+		cm.serveSocket(l, events, quit)
+	})
+
+	cm.logger().Infof("listening for reload commands on %s", path)
+
+	return nil
+}
+
+// serveSocket serves connections to the socket listened on by l until
+// quit is closed, then closes it.
+func (cm *CertMan) serveSocket(l net.Listener, events <-chan Event, quit <-chan struct{}) {
+	var mu sync.Mutex
+	conns := map[net.Conn]bool{}
+
+	go func() {
+		for {
+			var e Event
+			var ok bool
+			select {
+			case e, ok = <-events:
+				if !ok {
+					return
+				}
+			case <-quit:
+				return
+			}
+
+			var line string
+			switch e.Type {
+			case EventLoaded:
+				line = fmt.Sprintf("loaded %s %s\n", e.Path, hex.EncodeToString(e.Fingerprint[:]))
+			case EventLoadFailed:
+				line = fmt.Sprintf("load_failed %s %v\n", e.Path, e.Err)
+			default:
+				continue
+			}
+
+			mu.Lock()
+			for c := range conns {
+				c.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+				c.Write([]byte(line))
+			}
+			mu.Unlock()
+		}
+	}()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns[c] = true
+			mu.Unlock()
+
+			go func() {
+				s := bufio.NewScanner(c)
+				for s.Scan() {
+					switch cmd := strings.TrimSpace(s.Text()); cmd {
+					case "reload":
+						cm.Reload()
+					default:
+						mu.Lock()
+						fmt.Fprintf(c, "unknown command %q\n", cmd)
+						mu.Unlock()
+					}
+				}
+
+				mu.Lock()
+				delete(conns, c)
+				mu.Unlock()
+				c.Close()
+			}()
+		}
+	}()
+
+	<-quit
+	l.Close()
+
+	mu.Lock()
+	for c := range conns {
+		c.Close()
+	}
+	mu.Unlock()
+}
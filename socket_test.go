@@ -0,0 +1,66 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestListenSocket(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "certman.sock")
+	if err := cm.ListenSocket(path); err != nil {
+		t.Fatalf("could not listen on socket: %v", err)
+	}
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("could not dial socket: %v", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(time.Second))
+	r := bufio.NewReader(c)
+
+	// Wait for the connection to be accepted before reloading.
+	c.Write([]byte("ping\n"))
+	if line, err := r.ReadString('\n'); err != nil || line != "unknown command \"ping\"\n" {
+		t.Fatalf("unexpected reply to unknown command: %q, %v", line, err)
+	}
+
+	c.Write([]byte("reload\n"))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("could not read from socket: %v", err)
+	}
+	if want := "loaded " + certFile + " "; !strings.HasPrefix(line, want) {
+		t.Fatalf("read %q from socket, want prefix %q", line, want)
+	}
+
+	cm.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket not removed after stop: %v", err)
+	}
+}
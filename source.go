@@ -0,0 +1,170 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Source provides a certificate and key from storage other than
+// files. Read returns the PEM encoded certificate and key along with
+// a token that changes whenever they do, such as a version or an
+// ETag.
+type Source interface {
+	Read() (cert, key []byte, token string, err error)
+}
+
+// A LeafSource is a Source that can also return the parsed leaf of the
+// certificate it reads, for callers that have already parsed it. ReadLeaf
+// is called in place of Read, and the leaf, if not nil, is used as the
+// Leaf of the loaded certificate rather than parsing it again, once
+// checked to be the first certificate in cert.
+type LeafSource interface {
+	Source
+	ReadLeaf() (cert, key []byte, leaf *x509.Certificate, token string, err error)
+}
+
+// sourceName names a Source in logs and the parse cache.
+const sourceName = "source"
+
+// A sourceRead is the result of a call to Source.Read.
+type sourceRead struct {
+	cert, key []byte
+	leaf      *x509.Certificate
+	token     string
+	err       error
+}
+
+// NewWithSource creates a new certMan loading the certificate and key
+// from src rather than files. Watch polls src every interval and
+// reloads when the token it returns changes. If src is a LeafSource
+// the leaf it returns is used rather than parsed again. Otherwise
+// certMan behaves as one created by New, though the options concerning
+// the certificate and key files have no effect.
+func NewWithSource(src Source, interval time.Duration) (*CertMan, error) {
+	if src == nil {
+		return nil, errors.New("nil source")
+	}
+
+	if interval <= 0 {
+		return nil, errors.New("source poll interval must be positive")
+	}
+
+	cm := newCertMan()
+	cm.source = src
+	cm.interval = interval
+
+	return cm, nil
+}
+
+// loadSource loads the certificate and key from the source, using the
+// read made by poll if there is one.
+func (cm *CertMan) loadSource() (*tls.Certificate, error) {
+	cm.mu.Lock()
+	r := cm.polled
+	cm.polled = nil
+	cm.mu.Unlock()
+
+	if r == nil {
+		r = cm.readSource()
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "can't read source")
+	}
+
+	cm.mu.Lock()
+	cm.token = r.token
+	cm.mu.Unlock()
+
+	return cm.parseKeyPair(sourceName, sourceName, r.cert, r.key, r.leaf)
+}
+
+// readSource reads the certificate and key from the source, along with
+// the leaf if it is a LeafSource.
+func (cm *CertMan) readSource() *sourceRead {
+	r := &sourceRead{}
+	if src, ok := cm.source.(LeafSource); ok {
+		r.cert, r.key, r.leaf, r.token, r.err = src.ReadLeaf()
+	} else {
+		r.cert, r.key, r.token, r.err = cm.source.Read()
+	}
+
+	return r
+}
+
+// certName returns the name of the certificate served by default in
+// logs: its file, or the source if created by NewWithSource.
+func (cm *CertMan) certName() string {
+	if cm.source != nil {
+		return sourceName
+	}
+
+	certFile, _ := cm.files()
+
+	return certFile
+}
+
+// watchSource starts polling the source for changes.
+func (cm *CertMan) watchSource() error {
+	cm.reload()
+	cm.loadPairs(nil)
+
+	cm.logger().Infof("polling source for cert and key change")
+	cm.emit(sinkWatchStarted, "", nil, nil)
+
+	cm.mu.Lock()
+	cm.watching = make(chan bool)
+	select {
+	case <-cm.done:
+		cm.done = make(chan struct{})
+	default:
+	}
+	done := cm.done
+	cm.renewQuit()
+	cm.mu.Unlock()
+
+	cm.startUptime()
+	go cm.poll(done)
+
+	return nil
+}
+
+// poll reads the source every interval, reloading when its token
+// changes, until watching stops.
+func (cm *CertMan) poll(done chan struct{}) {
+	defer func() { cm.watchStopped(recover()) }()
+	defer close(done)
+	defer cm.stopUptime()
+
+	ticker := time.NewTicker(cm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.watching:
+			cm.logger().Infof("stopped watching")
+			cm.emit(sinkWatchStopped, "", nil, nil)
+			return
+		case <-ticker.C:
+			r := cm.readSource()
+
+			cm.mu.Lock()
+			changed := r.err != nil || r.token != cm.token
+			if changed {
+				cm.polled = r
+			}
+			cm.mu.Unlock()
+
+			if changed {
+				cm.reload()
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+// memSource is a Source holding a certificate and key in memory.
+type memSource struct {
+	mu        sync.Mutex
+	cert, key []byte
+	token     string
+}
+
+func (s *memSource) Read() ([]byte, []byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cert, s.key, s.token, nil
+}
+
+func (s *memSource) set(t *testing.T, token string, hosts ...string) {
+	certFile, keyFile := certmantest.GeneratePair(t, hosts...)
+
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	s.cert, s.key, s.token = cert, key, token
+	s.mu.Unlock()
+}
+
+func TestSource(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	src := &memSource{}
+	src.set(t, "1", "old.example.com")
+
+	cm, err := certman.NewWithSource(src, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch source: %v", err)
+	}
+	defer cm.Stop()
+
+	if got := servedName(t, cm, ""); got != "old.example.com" {
+		t.Fatalf("serving %q, want old.example.com", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := strings.Count(buf.String(), "certificate and key loaded\n"); n != 1 {
+		t.Fatalf("loaded %d times with an unchanged token, want 1", n)
+	}
+
+	src.set(t, "2", "new.example.com")
+	time.Sleep(100 * time.Millisecond)
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after token changed, want new.example.com", got)
+	}
+}
+
+// leafSource is a memSource that also returns a parsed leaf.
+type leafSource struct {
+	memSource
+	leaf *x509.Certificate
+}
+
+func (s *leafSource) ReadLeaf() ([]byte, []byte, *x509.Certificate, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cert, s.key, s.leaf, s.token, nil
+}
+
+// parse sets the leaf to the certificate the source holds.
+func (s *leafSource) parse(t *testing.T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	block, _ := pem.Decode(s.cert)
+	if block == nil {
+		t.Fatal("no certificate in source")
+	}
+
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.leaf = leaf
+}
+
+func TestLeafSource(t *testing.T) {
+	src := &leafSource{}
+	src.set(t, "1", "leaf.example.com")
+	src.parse(t)
+
+	cm, err := certman.NewWithSource(src, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(log.New(new(syncBuffer), "", 0))
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch source: %v", err)
+	}
+	defer cm.Stop()
+
+	cert, err := cm.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("could not get certman certificate: %v", err)
+	}
+
+	if cert.Leaf != src.leaf {
+		t.Fatalf("served leaf isn't the one provided by the source")
+	}
+}
+
+func TestLeafSourceMismatch(t *testing.T) {
+	src := &leafSource{}
+	src.set(t, "1", "other.example.com")
+	src.parse(t)
+	src.set(t, "1", "leaf.example.com")
+
+	cm, err := certman.NewWithSource(src, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(log.New(new(syncBuffer), "", 0))
+	cm.Watch()
+	defer cm.Stop()
+
+	if err := cm.LastError(); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Fatalf("got error %v, want leaf mismatch", err)
+	}
+}
+
+func TestNewWithSourceInvalid(t *testing.T) {
+	if _, err := certman.NewWithSource(nil, time.Second); err == nil {
+		t.Fatalf("nil source accepted")
+	}
+
+	if _, err := certman.NewWithSource(&memSource{}, 0); err == nil {
+		t.Fatalf("zero poll interval accepted")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "time"
+
+// ReloadStats summarises the loads of the certificate and key over
+// time, for tracking how often certificates rotate.
+type ReloadStats struct {
+	// Reloads is the number of successful loads.
+	Reloads uint64
+
+	// Failures is the number of failed loads.
+	Failures uint64
+
+	// MeanBetweenReloads is the mean time between successful loads,
+	// or zero until there have been two.
+	MeanBetweenReloads time.Duration
+
+	// Uptime is how long the current watch has been running, or zero
+	// if certMan isn't watching.
+	Uptime time.Duration
+}
+
+// Stats returns statistics on the loads of the certificate and key.
+// The counts and mean cover every load since certMan was created,
+// including the first, and aren't reset when watching stops or starts
+// again. Uptime restarts with each call to Watch.
+func (cm *CertMan) Stats() ReloadStats {
+	stats := ReloadStats{
+		Reloads:  cm.reloads.Load(),
+		Failures: cm.loadFailures.Load(),
+	}
+
+	if first, last := cm.firstLoad.Load(), cm.lastLoad.Load(); stats.Reloads > 1 && last > first {
+		stats.MeanBetweenReloads = time.Duration(last-first) / time.Duration(stats.Reloads-1)
+	}
+
+	if started := cm.watchStart.Load(); started != 0 {
+		stats.Uptime = time.Since(time.Unix(0, started))
+	}
+
+	return stats
+}
+
+// countLoad records the outcome of a load started at started.
+func (cm *CertMan) countLoad(started time.Time, err error) {
+	if err != nil {
+		cm.loadFailures.Add(1)
+		return
+	}
+
+	cm.firstLoad.CompareAndSwap(0, started.UnixNano())
+	cm.lastLoad.Store(started.UnixNano())
+	cm.reloads.Add(1)
+}
+
+// startUptime records that a watch loop is starting.
+func (cm *CertMan) startUptime() {
+	cm.watchStart.Store(time.Now().UnixNano())
+}
+
+// stopUptime records that a watch loop stopped.
+func (cm *CertMan) stopUptime() {
+	cm.watchStart.Store(0)
+}
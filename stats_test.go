@@ -0,0 +1,57 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestStats(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	_, otherKey := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	start := cm.Stats()
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := cm.Reload(); err != nil {
+		t.Fatalf("could not reload: %v", err)
+	}
+
+	copyFile(otherKey, keyFile)
+	if _, err := cm.Reload(); err == nil {
+		t.Fatal("mismatched key loaded")
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	stats := cm.Stats()
+	if stats.Reloads-start.Reloads != 2 || stats.Failures-start.Failures == 0 {
+		t.Fatalf("want 2 more reloads and a failure than %+v, got %+v", start, stats)
+	}
+	if stats.MeanBetweenReloads <= 0 {
+		t.Fatalf("mean time between reloads not recorded: %+v", stats)
+	}
+	if stats.Uptime < 200*time.Millisecond {
+		t.Fatalf("uptime %v shorter than the watch", stats.Uptime)
+	}
+
+	cm.Stop()
+
+	if stats := cm.Stats(); stats.Uptime != 0 {
+		t.Fatalf("uptime %v after watching stopped", stats.Uptime)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Status describes the state of the certificate and key loads.
+type Status struct {
+	// Loaded reports whether a certificate is loaded and being served.
+	Loaded bool
+
+	// Failures is the number of consecutive failed loads since the
+	// last successful one.
+	Failures int
+
+	// Stuck reports whether Failures has reached the threshold set by
+	// SetFailureThreshold and the loads have been failing for longer
+	// than the grace period set by SetFailureGracePeriod.
+	Stuck bool
+
+	// Stapled reports whether an OCSP response is stapled to the
+	// served certificate.
+	Stapled bool
+
+	// StapleNextUpdate is the NextUpdate of the stapled OCSP
+	// response, or the zero time if there isn't one.
+	StapleNextUpdate time.Time
+}
+
+// Status returns the current status of certMan.
+func (cm *CertMan) Status() Status {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	status := Status{
+		Loaded:   cm.keyPair != nil,
+		Failures: cm.failures,
+		Stuck:    cm.stuck(),
+	}
+
+	if cm.keyPair != nil && cm.keyPair.OCSPStaple != nil {
+		status.Stapled = true
+		status.StapleNextUpdate = stapleNextUpdate(cm.keyPair.OCSPStaple)
+	}
+
+	return status
+}
+
+// stuck reports whether the loads have failed for long enough to be
+// considered stuck. cm.mu must be held for reading.
+func (cm *CertMan) stuck() bool {
+	if cm.failures == 0 || (cm.threshold <= 0 && cm.grace <= 0) {
+		return false
+	}
+
+	if cm.threshold > 0 && cm.failures < cm.threshold {
+		return false
+	}
+
+	return cm.now().Sub(cm.failedAt) >= cm.grace
+}
+
+// LastError returns the most recent error loading or watching the
+// certificate and key files, or nil if the load since succeeded.
+func (cm *CertMan) LastError() error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.lastErr
+}
+
+// SetFailureGracePeriod sets how long loads must have been failing,
+// since the first of the consecutive failures, before certMan reports
+// itself stuck, so brief failures while files are rotated don't. It
+// applies alongside any threshold set by SetFailureThreshold. A grace
+// period of zero, the default, reports stuck as soon as the threshold
+// is reached.
+func (cm *CertMan) SetFailureGracePeriod(d time.Duration) {
+	cm.mu.Lock()
+	cm.grace = d
+	cm.mu.Unlock()
+}
+
+// setLastError records err as the most recent error.
+func (cm *CertMan) setLastError(err error) {
+	cm.mu.Lock()
+	cm.lastErr = err
+	cm.mu.Unlock()
+}
+
+// SetFailureThreshold sets the number of consecutive failed loads
+// after which certMan considers itself stuck. Failures before the
+// threshold are logged as warnings, reaching it is logged once as an
+// error and later failures aren't logged until a load succeeds again.
+// A threshold of zero, the default, logs every failure as an error.
+func (cm *CertMan) SetFailureThreshold(n int) {
+	cm.mu.Lock()
+	cm.threshold = n
+	cm.mu.Unlock()
+}
+
+// A queuedReload is a reload waiting for the one in progress to
+// finish, shared by every caller requesting a reload meanwhile.
+type queuedReload struct {
+	done    chan struct{}
+	err     error
+	trigger fsnotify.Event
+}
+
+// reload loads the certificate and key, logging any failure according
+// to the failure threshold. Only one load runs at a time, so Stop can
+// wait for one in progress, and at most one more is queued behind it:
+// callers arriving while one is queued share its result, as it starts
+// after they asked.
+func (cm *CertMan) reload() error {
+	return cm.reloadFor(fsnotify.Event{})
+}
+
+// reloadFor is reload for a change reported by the watch event
+// trigger, which is passed to the callbacks registered with OnReload.
+// A reload shared by several callers is reported as triggered by the
+// first event among them.
+func (cm *CertMan) reloadFor(trigger fsnotify.Event) error {
+	cm.mu.Lock()
+	if q := cm.queued; q != nil {
+		if q.trigger.Name == "" {
+			q.trigger = trigger
+		}
+		cm.mu.Unlock()
+		<-q.done
+		return q.err
+	}
+	q := &queuedReload{done: make(chan struct{}), trigger: trigger}
+	cm.queued = q
+	cm.mu.Unlock()
+
+	var report func()
+	func() {
+		cm.reloadMu.Lock()
+		defer cm.reloadMu.Unlock()
+		defer close(q.done)
+
+		cm.mu.Lock()
+		cm.queued = nil
+		trigger = q.trigger
+		cm.mu.Unlock()
+
+		report, q.err = cm.loadAndRecord(trigger)
+	}()
+
+	// Report once reloadMu is released so that callbacks, metrics and
+	// the sink may call Reload or Stop.
+	report()
+
+	return q.err
+}
+
+// loadAndRecord loads the certificate and key and records the outcome,
+// returning a func that reports it to the metrics, the sink, the
+// callbacks registered with OnReload and the logger.
+func (cm *CertMan) loadAndRecord(trigger fsnotify.Event) (func(), error) {
+	started := time.Now()
+	prev := cm.fingerprint()
+	err := cm.load()
+	latency := time.Since(started)
+	cm.countLoad(started, err)
+
+	cm.mu.Lock()
+	failures, threshold := cm.failures, cm.threshold
+	cm.lastErr = err
+	notAfter, metrics := cm.info.NotAfter, cm.metrics
+	if err == nil {
+		cm.failures = 0
+		cm.loadedAt = started
+		cm.signalReload()
+	} else {
+		if cm.failures == 0 {
+			cm.failedAt = cm.now()
+		}
+		cm.failures++
+	}
+	cm.mu.Unlock()
+
+	certFile, _ := cm.files()
+	var der []byte
+	notify := func() {}
+	if err == nil {
+		der = cm.loadedDER()
+		notify = cm.reloadNotifier(trigger, prev)
+	}
+
+	report := func() {
+		metrics.ObserveReloadLatency(latency)
+		if err == nil {
+			metrics.IncReload()
+			metrics.SetExpiry(notAfter)
+		} else {
+			metrics.IncError()
+		}
+
+		if err == nil {
+			cm.emit(sinkLoaded, certFile, der, nil)
+			notify()
+		} else {
+			cm.emit(sinkLoadFailed, certFile, nil, err)
+		}
+
+		switch {
+		case err == nil:
+			if threshold > 0 && failures >= threshold {
+				cm.logger().Infof("recovered after %d failed loads", failures)
+			}
+		case threshold <= 0:
+			cm.logger().Errorf("can't load cert or key file: %v", err)
+		case failures+1 < threshold:
+			cm.logger().Warnf("can't load cert or key file: %v", err)
+		case failures+1 == threshold:
+			cm.logger().Errorf("can't load cert or key file after %d attempts, suppressing further errors: %v", threshold, err)
+		}
+	}
+
+	return report, err
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+)
+
+func TestFailureThreshold(t *testing.T) {
+	buf := new(syncBuffer)
+
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{buf})
+	cm.SetFailureThreshold(3)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	for i := 0; i < 3; i++ {
+		copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	status := cm.Status()
+	if status.Loaded || !status.Stuck || status.Failures < 3 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	logGot := buf.String()
+	if n := strings.Count(logGot, "WARN can't load cert or key file"); n != 2 {
+		t.Log("log output received:", logGot)
+		t.Fatalf("expected 2 warnings, got %d", n)
+	}
+	if n := strings.Count(logGot, "ERROR can't load cert or key file after 3 attempts"); n != 1 {
+		t.Log("log output received:", logGot)
+		t.Fatalf("expected 1 error, got %d", n)
+	}
+
+	buf.Reset()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+	time.Sleep(200 * time.Millisecond)
+
+	status = cm.Status()
+	if !status.Loaded || status.Stuck || status.Failures != 0 {
+		t.Fatalf("unexpected status after recovery: %+v", status)
+	}
+	if !strings.Contains(buf.String(), "INFO recovered after") {
+		t.Log("log output received:", buf.String())
+		t.Fatalf("recovery not logged")
+	}
+}
+
+func TestLastError(t *testing.T) {
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	if err := cm.LastError(); err != nil {
+		t.Fatalf("unexpected last error: %v", err)
+	}
+
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
+	time.Sleep(200 * time.Millisecond)
+
+	if err := cm.LastError(); err == nil || !strings.Contains(err.Error(), "private key does not match public key") {
+		t.Fatalf("unexpected last error: %v", err)
+	}
+
+	copyPair(dir, "./testdata/server2.crt", "./testdata/server2.key")
+	waitReload(t, cm)
+
+	if err := cm.LastError(); err != nil {
+		t.Fatalf("last error not reset by successful load: %v", err)
+	}
+}
+
+func TestFailureGracePeriod(t *testing.T) {
+	dir := t.TempDir()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
+
+	cm, err := certman.New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	c := newClock()
+	cm.SetClock(c.Now)
+	cm.SetFailureThreshold(2)
+	cm.SetFailureGracePeriod(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		cm.Reload()
+		c.Advance(10 * time.Second)
+	}
+
+	if status := cm.Status(); status.Failures != 3 || status.Stuck {
+		t.Fatalf("stuck within grace period: %+v", status)
+	}
+
+	c.Advance(time.Minute)
+	cm.Reload()
+
+	if status := cm.Status(); !status.Stuck {
+		t.Fatalf("not stuck after grace period: %+v", status)
+	}
+
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server1.key")
+	cm.Reload()
+	copyPair(dir, "./testdata/server1.crt", "./testdata/server2.key")
+	cm.Reload()
+	cm.Reload()
+
+	if status := cm.Status(); status.Stuck {
+		t.Fatalf("grace period not restarted after successful load: %+v", status)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "github.com/pkg/errors"
+
+// OnWatchStopped registers fn to be called once each time watching
+// stops, whether by Stop, when err is nil, or because the watching
+// goroutine failed, when err describes the failure, so a failed watch
+// can be alerted on and the process restarted or Watch called again.
+// fn is called from the watching goroutine after Done is closed, so it
+// may call Watch. A panic in the watching goroutine, such as from a
+// callback registered with OnReload, is recovered and passed to fn as
+// the error rather than crashing the process.
+func (cm *CertMan) OnWatchStopped(fn func(err error)) {
+	cm.mu.Lock()
+	cm.onStopped = append(cm.onStopped, fn)
+	cm.mu.Unlock()
+}
+
+// watchStopped calls the callbacks registered with OnWatchStopped once
+// a watching goroutine exits, r being the value it recovered from a
+// panic with, if any.
+func (cm *CertMan) watchStopped(r interface{}) {
+	var err error
+	if r != nil {
+		err = errors.Errorf("watching stopped unexpectedly: %v", r)
+		cm.setLastError(err)
+		cm.logger().Errorf("%v", err)
+	}
+
+	cm.mu.RLock()
+	stopped := cm.onStopped
+	cm.mu.RUnlock()
+
+	for _, fn := range stopped {
+		fn(err)
+	}
+}
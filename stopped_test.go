@@ -0,0 +1,109 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestOnWatchStopped(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	stopped := make(chan error, 4)
+	cm.OnWatchStopped(func(err error) { stopped <- err })
+
+	for i := 0; i < 2; i++ {
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		cm.Stop()
+
+		select {
+		case err := <-stopped:
+			if err != nil {
+				t.Fatalf("clean stop reported error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("stop not reported")
+		}
+	}
+
+	select {
+	case <-stopped:
+		t.Fatal("stop reported more than once per watch")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOnWatchStoppedAfterPanic(t *testing.T) {
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+
+	var panicked atomic.Bool
+	cm.OnReload(func(e certman.ReloadEvent) {
+		if e.File != "" && !panicked.Swap(true) {
+			panic("callback failed")
+		}
+	})
+
+	stopped, restarted := make(chan error, 4), make(chan error, 4)
+	cm.OnWatchStopped(func(err error) {
+		stopped <- err
+		if err != nil {
+			restarted <- cm.Watch()
+		}
+	})
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	copyFile("./testdata/server2.crt", crt)
+	copyFile("./testdata/server2.key", key)
+
+	select {
+	case err := <-stopped:
+		if err == nil || !strings.Contains(err.Error(), "callback failed") {
+			t.Fatalf("panic not reported: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic not reported")
+	}
+	if err := <-restarted; err != nil {
+		t.Fatalf("could not watch files again: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+	waitReload(t, cm)
+
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatal("change not loaded after restarting watching")
+	}
+}
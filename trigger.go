@@ -0,0 +1,31 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+// WatchTrigger starts a goroutine that reloads the certificate and key,
+// and any pairs added with AddPair, each time a value is received from
+// trigger, for callers with their own change detection such as a
+// configuration management daemon. Reloads are as by Reload, including
+// the callbacks and events of each load. It can be used instead of
+// Watch, or alongside it when a reload triggered while one from a
+// watch event is in progress is queued behind it. The goroutine exits
+// when trigger is closed or Stop is called, and in the latter case
+// starts again when Watch is next called.
+func (cm *CertMan) WatchTrigger(trigger <-chan struct{}) {
+	cm.goSession(func(quit <-chan struct{}) {
+		for {
+			select {
+			case _, ok := <-trigger:
+				if !ok {
+					return
+				}
+			case <-quit:
+				return
+			}
+
+			cm.Reload()
+		}
+	})
+}
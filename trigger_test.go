@@ -0,0 +1,91 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+)
+
+func TestWatchTrigger(t *testing.T) {
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.LeveledLogger(levelLogger{new(syncBuffer)})
+	trigger := make(chan struct{})
+	cm.WatchTrigger(trigger)
+	defer close(trigger)
+
+	trigger <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("pair not loaded on trigger")
+	}
+
+	// Without Watch, changes are only loaded when triggered.
+	copyFile("./testdata/server2.crt", crt)
+	copyFile("./testdata/server2.key", key)
+	time.Sleep(100 * time.Millisecond)
+
+	if !servedCert(t, cm, "./testdata/server1.crt", "./testdata/server1.key") {
+		t.Fatalf("pair changed before trigger")
+	}
+
+	trigger <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+
+	if !servedCert(t, cm, "./testdata/server2.crt", "./testdata/server2.key") {
+		t.Fatalf("changed pair not loaded on trigger")
+	}
+}
+
+func TestWatchTriggerAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	crt, key := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile("./testdata/server1.crt", crt)
+	copyFile("./testdata/server1.key", key)
+
+	cm, err := certman.New(crt, key)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	trigger := make(chan struct{})
+	cm.WatchTrigger(trigger)
+	defer close(trigger)
+
+	for i := 0; i < 2; i++ {
+		if err := cm.Watch(); err != nil {
+			t.Fatalf("could not watch files: %v", err)
+		}
+		cm.Stop()
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	reloads := make(chan certman.ReloadEvent, 1)
+	cm.OnReload(func(e certman.ReloadEvent) { reloads <- e })
+
+	select {
+	case trigger <- struct{}{}:
+	case <-time.After(time.Second):
+		t.Fatal("trigger not received after watching restarted")
+	}
+	nextReload(t, reloads)
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+)
+
+// errNotValidated is returned by GetCertificate while serving is
+// gated on validation and no certificate has passed it.
+var errNotValidated = errors.New("no certificate has passed validation")
+
+// SetValidator sets a function every loaded certificate must pass
+// before it is served, for enforcing policies such as key types or
+// issuers. A certificate failing validation isn't loaded and the
+// previously loaded certificate, if any, continues to be served.
+// Certificates loaded before the validator was set aren't checked
+// until they are next loaded.
+func (cm *CertMan) SetValidator(fn func(*tls.Certificate) error) {
+	cm.mu.Lock()
+	cm.validator = fn
+	cm.validated = false
+	cm.storeSnapshot()
+	cm.mu.Unlock()
+}
+
+// RequireValidation sets whether GetCertificate and
+// GetClientCertificate return an error, aborting the handshake, until
+// a certificate that passed the validator set by SetValidator has been
+// loaded. This ensures a certificate violating the policy is never
+// served, even one loaded before the validator was set.
+func (cm *CertMan) RequireValidation(require bool) {
+	cm.mu.Lock()
+	cm.gated = require
+	cm.storeSnapshot()
+	validated := cm.validated
+	cm.mu.Unlock()
+
+	if require && !validated {
+		cm.logger().Warnf("serving gated until a certificate passes validation")
+	}
+}
+
+// validate checks keyPair with the validator, if one is set.
+func (cm *CertMan) validate(keyPair *tls.Certificate) error {
+	cm.mu.RLock()
+	validator := cm.validator
+	cm.mu.RUnlock()
+
+	if validator == nil {
+		return nil
+	}
+
+	return errors.Wrap(validator(keyPair), "certificate failed validation")
+}
+
+// servable returns keyPair, or an error if serving is gated on
+// validation and no certificate has passed it.
+func (s *serveState) servable(keyPair *tls.Certificate) (*tls.Certificate, error) {
+	if s.gated {
+		return nil, errNotValidated
+	}
+
+	return keyPair, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func requireName(name string) func(*tls.Certificate) error {
+	return func(c *tls.Certificate) error {
+		for _, n := range c.Leaf.DNSNames {
+			if n == name {
+				return nil
+			}
+		}
+		return errors.New("missing " + name)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "good.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	cm.SetValidator(requireName("good.example.com"))
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	buf.Reset()
+	badCert, badKey := certmantest.GeneratePair(t, "bad.example.com")
+	copyFile(badCert, certFile)
+	copyFile(badKey, keyFile)
+	time.Sleep(200 * time.Millisecond)
+
+	logWant := "can't load cert or key file: certificate failed validation: missing good.example.com"
+	if logGot := buf.String(); !strings.Contains(logGot, logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", logGot)
+		t.Fatalf("log from certman not as expected")
+	}
+
+	if got := servedName(t, cm, ""); got != "good.example.com" {
+		t.Fatalf("certificate failing validation replaced the old one, serving %q", got)
+	}
+}
+
+func TestRequireValidation(t *testing.T) {
+	buf := new(syncBuffer)
+	l := log.New(buf, "", 0)
+
+	certFile, keyFile := certmantest.GeneratePair(t, "bad.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	cm.Logger(l)
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	// The certificate loaded before the validator was set isn't served.
+	cm.SetValidator(requireName("good.example.com"))
+	cm.RequireValidation(true)
+
+	if _, err := cm.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Fatalf("unvalidated certificate served")
+	}
+	if _, err := cm.GetClientCertificate(&tls.CertificateRequestInfo{}); err == nil {
+		t.Fatalf("unvalidated client certificate served")
+	}
+
+	buf.Reset()
+	goodCert, goodKey := certmantest.GeneratePair(t, "good.example.com")
+	copyFile(goodCert, certFile)
+	copyFile(goodKey, keyFile)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "good.example.com" {
+		t.Fatalf("validated certificate not served, serving %q", got)
+	}
+
+	logWant := "certificate passed validation, serving enabled"
+	if logGot := buf.String(); !strings.Contains(logGot, logWant) {
+		t.Log("log output expected:", logWant)
+		t.Log("log output received:", logGot)
+		t.Fatalf("log from certman not as expected")
+	}
+}
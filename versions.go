@@ -0,0 +1,100 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// A versionChain is a chain served to clients supporting minVersion
+// or later, and the loaded certificate with that chain.
+type versionChain struct {
+	minVersion uint16
+	chain      [][]byte
+	keyPair    *tls.Certificate
+}
+
+// AddVersionChain serves the certificates in the PEM encoded
+// chainFile after the leaf of the pair passed to New, in place of the
+// chain in its certificate file, to clients supporting minVersion or
+// later. For example a shorter chain can be served to TLS 1.3 clients
+// while older clients get a longer one for compatibility. The highest
+// version in the client's SupportedVersions is compared against each
+// chain's minVersion and the chain with the highest minVersion the
+// client supports is served. Clients supporting none of them are
+// served the chain from the certificate file and any intermediates
+// directory as usual. chainFile is read once and not watched.
+func (cm *CertMan) AddVersionChain(minVersion uint16, chainFile string) error {
+	b, err := os.ReadFile(chainFile)
+	if err != nil {
+		return errors.Wrap(err, "can't read chain file")
+	}
+
+	var chain [][]byte
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+
+	cm.mu.Lock()
+	cm.chains = append(cm.chains, &versionChain{minVersion: minVersion, chain: chain})
+	sort.SliceStable(cm.chains, func(i, j int) bool {
+		return cm.chains[i].minVersion > cm.chains[j].minVersion
+	})
+	cm.buildChains()
+	cm.storeSnapshot()
+	cm.mu.Unlock()
+
+	return nil
+}
+
+// buildChains builds the certificates served with each version chain
+// from the loaded certificate. cm.mu must be held for writing.
+func (cm *CertMan) buildChains() {
+	for _, c := range cm.chains {
+		c.keyPair = nil
+		if cm.keyPair == nil {
+			continue
+		}
+
+		keyPair := *cm.keyPair
+		keyPair.Certificate = append([][]byte{cm.keyPair.Certificate[0]}, c.chain...)
+		c.keyPair = &keyPair
+	}
+}
+
+// chainFor returns keyPair with the chain to serve to the client
+// sending hello.
+func (s *serveState) chainFor(keyPair *tls.Certificate, hello *tls.ClientHelloInfo) *tls.Certificate {
+	if keyPair == nil || keyPair != s.keyPair {
+		return keyPair
+	}
+
+	var max uint16
+	for _, v := range hello.SupportedVersions {
+		// Skip GREASE values, which are of the form 0x?a?a.
+		if v&0x0f0f != 0x0a0a && v > max {
+			max = v
+		}
+	}
+
+	for _, c := range s.chains {
+		if max >= c.minVersion {
+			return c.keyPair
+		}
+	}
+
+	return keyPair
+}
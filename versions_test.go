@@ -0,0 +1,52 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestVersionChain(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "example.com")
+	chainFile, _ := certmantest.GeneratePair(t, "intermediate.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.AddVersionChain(tls.VersionTLS12, chainFile); err != nil {
+		t.Fatalf("could not add version chain: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	tests := []struct {
+		versions []uint16
+		want     int
+	}{
+		{[]uint16{0x0a0a, tls.VersionTLS13, tls.VersionTLS12}, 2},
+		{[]uint16{tls.VersionTLS12}, 2},
+		{[]uint16{tls.VersionTLS11, tls.VersionTLS10}, 1},
+		{[]uint16{0x1a1a}, 1},
+	}
+
+	for _, tt := range tests {
+		cert, err := cm.GetCertificate(&tls.ClientHelloInfo{SupportedVersions: tt.versions})
+		if err != nil {
+			t.Fatalf("could not get certificate: %v", err)
+		}
+		if got := len(cert.Certificate); got != tt.want {
+			t.Errorf("versions %x: served chain of %d, want %d", tt.versions, got, tt.want)
+		}
+	}
+}
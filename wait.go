@@ -0,0 +1,39 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import "context"
+
+// WaitForReload blocks until the next successful load of the
+// certificate and key, whether from a watch event or Reload, returning
+// nil, or until ctx is done, returning its error. Failed loads and
+// loads of pairs added with AddPair don't end the wait. It waits for a
+// load finishing after it is called, so to confirm a rotation took
+// effect it should be called once the files are written: changes are
+// loaded after the coalesce window, which leaves time to call it.
+func (cm *CertMan) WaitForReload(ctx context.Context) error {
+	cm.mu.Lock()
+	if cm.nextReload == nil {
+		cm.nextReload = make(chan struct{})
+	}
+	next := cm.nextReload
+	cm.mu.Unlock()
+
+	select {
+	case <-next:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// signalReload ends the waits of WaitForReload after a successful
+// load. cm.mu must be held for writing.
+func (cm *CertMan) signalReload() {
+	if cm.nextReload != nil {
+		close(cm.nextReload)
+		cm.nextReload = nil
+	}
+}
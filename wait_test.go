@@ -0,0 +1,57 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestWaitForReload(t *testing.T) {
+	certFile, keyFile := certmantest.GeneratePair(t, "old.example.com")
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch files: %v", err)
+	}
+	defer cm.Stop()
+
+	newCert, newKey := certmantest.GeneratePair(t, "new.example.com")
+	copyFile(newCert, certFile)
+	copyFile(newKey, keyFile)
+	waitReload(t, cm)
+
+	if got := servedName(t, cm, ""); got != "new.example.com" {
+		t.Fatalf("serving %q after reload, want new.example.com", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := cm.WaitForReload(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait without a reload returned %v", err)
+	}
+}
+
+// waitReload waits for cm to next load its certificate and key.
+func waitReload(t *testing.T, cm *certman.CertMan) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := cm.WaitForReload(ctx); err != nil {
+		t.Fatalf("certificate not reloaded: %v", err)
+	}
+}
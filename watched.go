@@ -0,0 +1,30 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman
+
+import (
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// addWatch adds name to watcher, explaining the error if the watch
+// limit has been reached.
+func addWatch(watcher *fsnotify.Watcher, name string) error {
+	return watchLimit(watcher.Add(name))
+}
+
+// watchLimit explains err if it reports the inotify watch limit has
+// been reached, which fsnotify returns from Add as ENOSPC, "no space
+// left on device", a message that otherwise sends people looking at
+// their disks.
+func watchLimit(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return errors.Wrap(err, "watch limit reached, raise fs.inotify.max_user_watches")
+	}
+
+	return err
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Dyson Simmons. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certman_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/dyson/certman"
+	"github.com/dyson/certman/certmantest"
+)
+
+func TestWatchLimit(t *testing.T) {
+	err := certman.WatchLimit(syscall.ENOSPC)
+	if err == nil || !strings.Contains(err.Error(), "fs.inotify.max_user_watches") || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("watch limit not explained: %v", err)
+	}
+
+	if err := certman.WatchLimit(syscall.ENOENT); err != syscall.ENOENT {
+		t.Fatalf("other error changed: %v", err)
+	}
+
+	if err := certman.WatchLimit(nil); err != nil {
+		t.Fatalf("nil error changed: %v", err)
+	}
+}
+
+func TestWatchSplitDirectories(t *testing.T) {
+	certFile, pairKey := certmantest.GeneratePair(t, "example.com")
+	keyFile := filepath.Join(t.TempDir(), "tls.key")
+	copyFile(pairKey, keyFile)
+
+	cm, err := certman.New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not create certman: %v", err)
+	}
+
+	if err := cm.Watch(); err != nil {
+		t.Fatalf("could not watch split directories: %v", err)
+	}
+	cm.Stop()
+}